@@ -0,0 +1,65 @@
+package reload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// WithApproval waits for Approve() before restarting when the binary changes,
+// instead of restarting straight away. Receiving one of the signals (if any)
+// also approves the restart:
+//
+//    reload.Do(log.Printf, reload.WithApproval(syscall.SIGUSR1))
+//
+// Only one restart is pending at a time; a newer binary replaces it. Use
+// Pending() to get the details, including the binary's checksum, and Reject()
+// to discard it. Restart(), Handler(), and WithSignal() still restart without
+// approval.
+func WithApproval(sig ...os.Signal) Option {
+	return optionFunc(func(r *reloader) {
+		r.approval = true
+		r.approveSignals = append(r.approveSignals, sig...)
+	})
+}
+
+// Approve() and Reject().
+var approvals = make(chan bool, 1)
+
+// Approve restarts the process for the pending restart, with WithApproval().
+//
+// Like Restart() this returns immediately. It does nothing if no restart is
+// waiting for approval.
+func Approve() { approve(true) }
+
+// Reject discards the pending restart, with WithApproval(); the next change to
+// the binary is pending again.
+//
+// It does nothing if no restart is waiting for approval.
+func Reject() { approve(false) }
+
+func approve(ok bool) {
+	if has, p := Pending(); !has || p.Policy != HeldByApproval {
+		return
+	}
+	select {
+	case approvals <- ok:
+	default:
+	}
+}
+
+// Get the hex-encoded SHA-256 checksum of the file at path.
+func checksum(path string) (string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,202 @@
+package reload
+
+import (
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestApproval(t *testing.T) {
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		restarted = make(chan Reason, 3)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(r Reason) { restarted <- r }), WithApproval())
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	sum, err := checksum(launch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notRestarted := func() {
+		t.Helper()
+		select {
+		case <-restarted:
+			t.Fatal("restarted without approval")
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	Approve() // Nothing pending.
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: new binary detected, awaiting approval")
+	notRestarted()
+	ok, p := Pending()
+	if !ok {
+		t.Fatal("nothing pending")
+	}
+	if p.Reason.Path != launch || p.Policy != HeldByApproval || p.Checksum != sum || time.Since(p.Detected) > time.Second {
+		t.Errorf("wrong pending: %#v", p)
+	}
+
+	w.events <- WatchEvent{Name: launch, Op: OpWrite}
+	l.wait(t, "INFO reload: newer binary detected, replacing the pending restart (checksum "+sum+")")
+	if _, p2 := Pending(); !p2.Detected.After(p.Detected) {
+		t.Errorf("not replaced: %#v", p2)
+	}
+
+	Reject()
+	l.wait(t, "INFO reload: rejected the pending restart")
+	notRestarted()
+	if ok, _ := Pending(); ok {
+		t.Error("still pending after Reject()")
+	}
+
+	w.events <- WatchEvent{Name: launch, Op: OpWrite}
+	for start := time.Now(); ; time.Sleep(5 * time.Millisecond) {
+		if ok, _ := Pending(); ok {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("nothing pending")
+		}
+	}
+	Approve()
+	select {
+	case r := <-restarted:
+		if r.Kind != BinaryChanged || r.Path != launch {
+			t.Errorf("wrong reason: %#v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+	if ok, _ := Pending(); ok {
+		t.Error("still pending after Approve()")
+	}
+
+	// Manual restarts don't need approval.
+	Restart()
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+}
+
+// A rebuild for a change that was approved while the command was running
+// shouldn't need to be approved again.
+func TestApprovalRebuild(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command")
+	}
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		restarted = make(chan Reason, 3)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(r Reason) { restarted <- r }),
+			WithApproval(), WithPreRestartCommand([]string{"sleep", "0.3"}, 0))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	approve := func() {
+		t.Helper()
+		w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+		for start := time.Now(); ; time.Sleep(5 * time.Millisecond) {
+			if ok, _ := Pending(); ok {
+				break
+			}
+			if time.Since(start) > time.Second {
+				t.Fatal("nothing pending")
+			}
+		}
+		Approve()
+	}
+	approve()
+	l.wait(t, "INFO reload: running")
+	approve() // While the command is running.
+
+	select {
+	case <-restarted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not restarted")
+	}
+	if ok, p := Pending(); ok {
+		t.Errorf("still pending: %#v", p)
+	}
+}
+
+// A newer binary needs to be approved even if the older one was approved and
+// is still postponed.
+func TestApprovalPostponed(t *testing.T) {
+	oldInterval := canRestartInterval
+	defer func() { canRestartInterval = oldInterval }()
+	canRestartInterval = 50 * time.Millisecond
+
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		restarted = make(chan Reason, 3)
+		canMu     sync.Mutex
+		can       bool
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(r Reason) { restarted <- r }), WithApproval(),
+			Config{CanRestart: func() bool { canMu.Lock(); defer canMu.Unlock(); return can }})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	waitPending := func(policy HoldPolicy) {
+		t.Helper()
+		for start := time.Now(); ; time.Sleep(5 * time.Millisecond) {
+			if ok, p := Pending(); ok && p.Policy == policy {
+				return
+			}
+			if time.Since(start) > time.Second {
+				t.Fatalf("not held by %s", policy)
+			}
+		}
+	}
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	waitPending(HeldByApproval)
+	Approve()
+	waitPending(HeldByCanRestart)
+
+	w.events <- WatchEvent{Name: launch, Op: OpWrite}
+	waitPending(HeldByApproval)
+	canMu.Lock()
+	can = true
+	canMu.Unlock()
+	select {
+	case <-restarted:
+		t.Fatal("restarted without approval")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	Approve()
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+}
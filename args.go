@@ -0,0 +1,70 @@
+package reload
+
+import (
+	"os"
+	"strings"
+)
+
+// Functions to modify the arguments for the new process, set by Do().
+var argFuncs []func([]string) []string
+
+// WithArgs modifies the command-line arguments passed to the new process on
+// restart. The function receives the arguments without the program name.
+//
+// This can be passed more than once; the functions are applied in order.
+func WithArgs(fn func(args []string) []string) Option {
+	return optionFunc(func(r *reloader) { r.args = append(r.args, fn) })
+}
+
+// WithDropArgs removes flags from the command-line arguments on restart; this
+// is useful for one-time flags such as "-migrate".
+//
+// Both the "-flag=value" and "-flag value" forms are removed; in the second
+// form the next argument is removed too, unless it starts with a "-". Flags are
+// matched by name, so "-migrate" also matches "--migrate" and vice versa.
+// Arguments after "--" are never removed.
+func WithDropArgs(flags ...string) Option {
+	return WithArgs(func(args []string) []string { return dropArgs(args, flags) })
+}
+
+// Get the arguments for the new process.
+func execArgs() []string {
+	args := append([]string{}, os.Args[1:]...)
+	for _, f := range argFuncs {
+		args = f(args)
+	}
+	return args
+}
+
+func dropArgs(args, flags []string) []string {
+	names := make(map[string]struct{}, len(flags))
+	for _, f := range flags {
+		names[strings.TrimLeft(f, "-")] = struct{}{}
+	}
+
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			return append(out, args[i:]...)
+		}
+		if len(a) < 2 || a[0] != '-' {
+			out = append(out, a)
+			continue
+		}
+
+		name := strings.TrimLeft(a, "-")
+		hasValue := false
+		if j := strings.IndexByte(name, '='); j > -1 {
+			name, hasValue = name[:j], true
+		}
+		if _, ok := names[name]; !ok {
+			out = append(out, a)
+			continue
+		}
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+		}
+	}
+	return out
+}
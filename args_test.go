@@ -0,0 +1,31 @@
+package reload
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDropArgs(t *testing.T) {
+	tests := []struct {
+		in, flags, want []string
+	}{
+		{[]string{}, []string{"-migrate"}, []string{}},
+		{[]string{"-v", "serve"}, []string{"-migrate"}, []string{"-v", "serve"}},
+		{[]string{"--migrate", "-v"}, []string{"--migrate"}, []string{"-v"}},
+		{[]string{"-v", "--migrate=up", "-x"}, []string{"--migrate"}, []string{"-v", "-x"}},
+		{[]string{"--migrate", "up", "-x"}, []string{"--migrate"}, []string{"-x"}},
+		{[]string{"-migrate", "up"}, []string{"--migrate"}, []string{}},
+		{[]string{"--migrate", "--seed=x", "a"}, []string{"--migrate", "--seed"}, []string{"a"}},
+		{[]string{"--migrated"}, []string{"--migrate"}, []string{"--migrated"}},
+		{[]string{"-v", "--", "--migrate"}, []string{"--migrate"}, []string{"-v", "--", "--migrate"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			out := dropArgs(tt.in, tt.flags)
+			if !reflect.DeepEqual(out, tt.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v", out, tt.want)
+			}
+		})
+	}
+}
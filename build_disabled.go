@@ -0,0 +1,53 @@
+//go:build reload_disabled
+// +build reload_disabled
+
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Do() and Exec() do nothing; see build_enabled.go.
+const buildDisabled = true
+
+// Op is a set of file operations.
+//
+// This has the same values as fsnotify.Op, which isn't imported with the
+// reload_disabled tag.
+type Op uint32
+
+// File operations.
+const (
+	OpCreate Op = 1 << iota
+	OpWrite
+	OpRemove
+	OpRename
+	OpChmod
+)
+
+func (op Op) String() string {
+	var s []string
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{{OpCreate, "CREATE"}, {OpRemove, "REMOVE"}, {OpWrite, "WRITE"}, {OpRename, "RENAME"}, {OpChmod, "CHMOD"}} {
+		if op&o.op == o.op {
+			s = append(s, o.name)
+		}
+	}
+	return strings.Join(s, "|")
+}
+
+// WatchEvent is a change sent by a Watcher.
+type WatchEvent struct {
+	Name string
+	Op   Op
+}
+
+func (e WatchEvent) String() string { return fmt.Sprintf("%q: %s", e.Name, e.Op) }
+
+func newFSWatcher() (Watcher, error) {
+	return nil, errors.New("built with the reload_disabled tag")
+}
@@ -0,0 +1,28 @@
+//go:build reload_disabled
+// +build reload_disabled
+
+package reload
+
+import (
+	"testing"
+)
+
+func TestBuildDisabled(t *testing.T) {
+	var (
+		l = new(testLogger)
+		w = newFakeWatcher()
+	)
+	err := Do(nil, WithLogger(l), WithWatcher(w), Dir(".", func() {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Added()) > 0 {
+		t.Errorf("watched paths: %q", w.Added())
+	}
+	l.wait(t, "INFO reload: not watching anything")
+
+	Exec()
+	if err := ExecErr(); !errorContains(err, "reload_disabled") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !reload_disabled
+// +build !reload_disabled
+
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Build with "-tags reload_disabled" to make Do() return without watching
+// anything and Exec() do nothing, e.g. for production builds. The API stays the
+// same, so callers don't need their own build tags.
+const buildDisabled = false
+
+// Op is a set of file operations.
+type Op = fsnotify.Op
+
+// File operations.
+const (
+	OpCreate = fsnotify.Create
+	OpWrite  = fsnotify.Write
+	OpRemove = fsnotify.Remove
+	OpRename = fsnotify.Rename
+	OpChmod  = fsnotify.Chmod
+)
+
+// WatchEvent is a change sent by a Watcher.
+type WatchEvent = fsnotify.Event
+
+type fsWatcher struct{ *fsnotify.Watcher }
+
+func newFSWatcher() (Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		if runtime.GOOS == "linux" && errors.Is(err, syscall.EMFILE) {
+			return nil, fmt.Errorf("%w; the inotify instance limit may have been reached; "+
+				"raise it with e.g. \"sysctl fs.inotify.max_user_instances=512\"", err)
+		}
+		return nil, err
+	}
+	return fsWatcher{w}, nil
+}
+
+func (w fsWatcher) Events() <-chan WatchEvent { return w.Watcher.Events }
+func (w fsWatcher) Errors() <-chan error      { return w.Watcher.Errors }
@@ -0,0 +1,36 @@
+package reload
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// Make sure the package still builds and works with the reload_disabled tag.
+func TestBuildTags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("-short")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not in PATH")
+	}
+
+	for _, args := range [][]string{
+		{"vet", "-tags", "reload_disabled", "."},
+		{"test", "-count=1", "-tags", "reload_disabled", "-run", "^TestBuildDisabled$", "."},
+	} {
+		out, err := exec.Command(gobin, args...).CombinedOutput()
+		if err != nil {
+			t.Errorf("go %q: %s\n%s", args, err, out)
+		}
+	}
+
+	out, err := exec.Command(gobin, "list", "-tags", "reload_disabled", "-deps", ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go list: %s\n%s", err, out)
+	}
+	if strings.Contains(string(out), "fsnotify") {
+		t.Errorf("fsnotify imported with reload_disabled:\n%s", out)
+	}
+}
@@ -0,0 +1,73 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+type killChildren struct {
+	sig  os.Signal
+	wait time.Duration
+}
+
+// Kill child processes in Exec(), set by Do().
+var killOpts *killChildren
+
+// WithKillChildren terminates all direct child processes before Exec()
+// replaces the process, as the new process has no way to manage them.
+//
+// The children are sent sig, and are killed with SIGKILL if they haven't
+// exited after wait. Errors listing or signalling the processes are logged, but
+// won't prevent the restart.
+//
+// On Linux the children are found with /proc. Other systems run
+// "ps -A -o pid=,ppid=,stat=", so ps needs to be in $PATH; this isn't
+// supported on Windows.
+func WithKillChildren(sig os.Signal, wait time.Duration) Option {
+	return optionFunc(func(r *reloader) { r.killChildren = &killChildren{sig: sig, wait: wait} })
+}
+
+func (k killChildren) run(ctx context.Context, log Logger) {
+	pids, err := childPids(os.Getpid())
+	if err != nil {
+		logError(log, fmt.Errorf("cannot list child processes: %w", err))
+		return
+	}
+	if len(pids) == 0 {
+		return
+	}
+
+	log.Infof("reload: sending %s to %d child processes", k.sig, len(pids))
+	signalPids(log, pids, k.sig)
+
+	deadline := time.Now().Add(k.wait)
+	for len(pids) > 0 && time.Now().Before(deadline) && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+		if pids, err = childPids(os.Getpid()); err != nil {
+			logError(log, fmt.Errorf("cannot list child processes: %w", err))
+			return
+		}
+	}
+	if len(pids) > 0 {
+		if ctx.Err() != nil {
+			logError(log, fmt.Errorf("shutdown timeout of %s reached while waiting for child processes", shutdownTimeout))
+		}
+		log.Infof("reload: killing %d child processes that are still running", len(pids))
+		signalPids(log, pids, syscall.SIGKILL)
+	}
+}
+
+func signalPids(log Logger, pids []int, sig os.Signal) {
+	for _, pid := range pids {
+		p, err := os.FindProcess(pid)
+		if err == nil {
+			err = p.Signal(sig)
+		}
+		if err != nil {
+			logError(log, fmt.Errorf("cannot send %s to child process %d: %w", sig, pid, err))
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package reload
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+)
+
+// Get all running (non-zombie) direct children of the process.
+func childPids(ppid int) ([]int, error) {
+	proc, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, p := range proc {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+
+		// Processes may exit while we're reading, so just skip errors.
+		stat, err := ioutil.ReadFile("/proc/" + p.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+
+		// Format is "pid (comm) state ppid ...", and comm may contain spaces
+		// and parenthesis.
+		i := bytes.LastIndexByte(stat, ')')
+		if i == -1 {
+			continue
+		}
+		f := bytes.Fields(stat[i+1:])
+		if len(f) < 2 || string(f[0]) == "Z" || string(f[1]) != strconv.Itoa(ppid) {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
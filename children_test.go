@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+package reload
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKillChildren(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  []string
+		want string
+	}{
+		{"sigterm", []string{"sleep", "10"}, "signal: terminated"},
+		{"sigkill", []string{"sh", "-c", "trap '' TERM; sleep 10 & wait; sleep 10"}, "signal: killed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.cmd[0], tt.cmd[1:]...)
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			pids, err := childPids(os.Getpid())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !containsInt(pids, cmd.Process.Pid) {
+				t.Fatalf("%d not in %v", cmd.Process.Pid, pids)
+			}
+
+			killChildren{sig: syscall.SIGTERM, wait: 200 * time.Millisecond}.run(context.Background(), LogFunc(log.Printf))
+
+			err = cmd.Wait()
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("\nout:  %v\nwant: %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func containsInt(list []int, n int) bool {
+	for _, l := range list {
+		if l == n {
+			return true
+		}
+	}
+	return false
+}
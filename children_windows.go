@@ -0,0 +1,7 @@
+package reload
+
+import "errors"
+
+func childPids(ppid int) ([]int, error) {
+	return nil, errors.New("not supported on Windows")
+}
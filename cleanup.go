@@ -0,0 +1,214 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdlog "log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+type exitFunc struct {
+	fn     func(context.Context)
+	caller string // Where it was registered, for errors.
+}
+
+var (
+	onExitMu sync.Mutex
+	onExit   []exitFunc
+
+	// How long every OnExit function may run, set by Do().
+	onExitTimeout = defaultOnExitTimeout
+
+	// How long everything before a restart may take, set by Do(). There is no
+	// limit if it's negative.
+	shutdownTimeout = defaultDrainTimeout
+
+	onBeforeRestartMu sync.Mutex
+	onBeforeRestart   []func(string)
+)
+
+// How long all OnBeforeRestart functions together may delay a restart.
+const beforeRestartTimeout = time.Second
+
+// Defaults for Config.DrainTimeout and Config.OnExitTimeout.
+const (
+	defaultDrainTimeout  = 10 * time.Second
+	defaultOnExitTimeout = 5 * time.Second
+)
+
+// OnExit registers a function to run right before the process is replaced or
+// exits for a restart; for example to remove a pidfile or flush logs. This
+// applies to all restarts: Exec(), ExecErr(), SpawnAndExit(), and
+// GracefulUpgrade().
+//
+// Functions are run in the reverse order they were registered in, like defer.
+// Every function may take up to Config.OnExitTimeout (5 seconds by default),
+// after which the restart continues without waiting for it, and all of them
+// together up to Config.DrainTimeout (10 seconds by default). Panics are
+// recovered and logged.
+//
+// The functions will run again if Exec() fails and is retried later.
+//
+// Afterwards os.Stdout and os.Stderr are synced, and the logger and the output
+// of the standard log package are flushed if they have a Flush() or Sync()
+// method, so that the last lines aren't lost. Use OnExit to flush any other
+// buffers.
+func OnExit(fn func()) { addOnExit(func(context.Context) { fn() }) }
+
+// OnExitContext is like OnExit, but the function gets a context which is
+// cancelled when the Config.DrainTimeout deadline is reached.
+func OnExitContext(fn func(ctx context.Context)) { addOnExit(fn) }
+
+func addOnExit(fn func(context.Context)) {
+	caller := "unknown"
+	if _, file, line, ok := runtime.Caller(2); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+
+	onExitMu.Lock()
+	defer onExitMu.Unlock()
+	onExit = append(onExit, exitFunc{fn: fn, caller: caller})
+}
+
+// OnBeforeRestart registers a function to call when a restart is about to
+// happen, before anything else is done for it; for example to tell connected
+// clients to reconnect in a moment. The reason describes why the restart
+// happened.
+//
+// Unlike OnExit this is a best-effort notification: all functions run at the
+// same time, and the restart continues after a second even if they didn't
+// finish.
+func OnBeforeRestart(fn func(reason string)) {
+	onBeforeRestartMu.Lock()
+	defer onBeforeRestartMu.Unlock()
+	onBeforeRestart = append(onBeforeRestart, fn)
+}
+
+func notifyBeforeRestart(log Logger, reason string) {
+	onBeforeRestartMu.Lock()
+	fns := append([]func(string){}, onBeforeRestart...)
+	onBeforeRestartMu.Unlock()
+	if len(fns) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(fns))
+	for _, fn := range fns {
+		go func(fn func(string)) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					logError(log, fmt.Errorf("panic in OnBeforeRestart function: %v\n%s", r, debug.Stack()))
+				}
+			}()
+			fn(reason)
+		}(fn)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(beforeRestartTimeout):
+		log.Debugf("reload: OnBeforeRestart functions didn't finish in %s; restarting anyway", beforeRestartTimeout)
+	}
+}
+
+// WithShutdownTimeout sets Config.DrainTimeout; it overrides the value in
+// Config if both are set.
+//
+// A value of 0 used to mean no limit, but now means the default of 10 seconds,
+// like Config.DrainTimeout; use a negative value for no limit.
+func WithShutdownTimeout(d time.Duration) Option {
+	return optionFunc(func(r *reloader) { r.shutdownTimeout = d })
+}
+
+// Get the context for everything before a restart, which is cancelled once
+// Config.DrainTimeout has passed.
+func drainContext() (context.Context, context.CancelFunc) {
+	if shutdownTimeout > 0 {
+		return context.WithTimeout(context.Background(), shutdownTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Run everything that needs to happen before the process is replaced or exits.
+func beforeRestart(log Logger, killChildren bool) {
+	ctx, cancel := drainContext()
+	defer cancel()
+	drain(ctx, log, killChildren)
+}
+
+// Like beforeRestart(), but stop waiting once ctx is done.
+func drain(ctx context.Context, log Logger, killChildren bool) {
+	runOnExit(ctx, log)
+	if killChildren && killOpts != nil {
+		killOpts.run(ctx, log)
+	}
+	flushOutput(log)
+}
+
+// Flush any buffered output, as it's lost when the process is replaced.
+// Errors are ignored, as syncing a terminal or pipe returns an error on some
+// systems.
+func flushOutput(log Logger) {
+	for _, v := range []interface{}{log, stdlog.Writer()} {
+		switch f := v.(type) {
+		case interface{ Flush() error }:
+			_ = f.Flush()
+		case interface{ Sync() error }:
+			_ = f.Sync()
+		}
+	}
+	_ = os.Stdout.Sync()
+	_ = os.Stderr.Sync()
+}
+
+func runOnExit(ctx context.Context, log Logger) {
+	onExitMu.Lock()
+	fns := append([]exitFunc{}, onExit...)
+	onExitMu.Unlock()
+
+	for i := len(fns) - 1; i >= 0; i-- {
+		done := make(chan struct{})
+		go func(fn func(context.Context)) {
+			defer close(done)
+			defer func() {
+				if r := recover(); r != nil {
+					logError(log, fmt.Errorf("panic in OnExit function: %v\n%s", r, debug.Stack()))
+				}
+			}()
+			fn(ctx)
+		}(fns[i].fn)
+
+		select {
+		case <-done:
+		case <-time.After(onExitTimeout):
+			logError(log, fmt.Errorf("OnExit function registered at %s didn't finish in %s; continuing restart",
+				fns[i].caller, onExitTimeout))
+		case <-ctx.Done():
+			var skipped []string
+			for j := i - 1; j >= 0; j-- {
+				skipped = append(skipped, fns[j].caller)
+			}
+			msg := fmt.Sprintf("shutdown timeout of %s reached while running OnExit function registered at %s; restarting anyway",
+				shutdownTimeout, fns[i].caller)
+			if len(skipped) > 0 {
+				msg += " without running the ones registered at " + strings.Join(skipped, ", ")
+			}
+			logError(log, errors.New(msg))
+			return
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package reload
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnExit(t *testing.T) {
+	oldTimeout := onExitTimeout
+	defer func() {
+		onExit, onExitTimeout = nil, oldTimeout
+	}()
+	onExitTimeout = 50 * time.Millisecond
+
+	var order []int
+	OnExit(func() { order = append(order, 1) })
+	OnExit(func() { panic("oops") })
+	OnExit(func() { time.Sleep(time.Second) })
+	OnExit(func() { order = append(order, 4) })
+
+	var logged []string
+	runOnExit(context.Background(), LogFunc(func(f string, a ...interface{}) { logged = append(logged, fmt.Sprintf(f, a...)) }))
+
+	if want := []int{4, 1}; !reflect.DeepEqual(order, want) {
+		t.Errorf("wrong order\nout:  %v\nwant: %v", order, want)
+	}
+	if len(logged) != 2 ||
+		!strings.Contains(logged[0], "didn't finish in 50ms") ||
+		!strings.Contains(logged[1], "panic in OnExit function: oops") {
+		t.Errorf("wrong log: %q", logged)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	oldTimeout := shutdownTimeout
+	defer func() {
+		onExit, shutdownTimeout = nil, oldTimeout
+	}()
+	shutdownTimeout = 50 * time.Millisecond
+
+	cancelled := make(chan struct{})
+	OnExitContext(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+		time.Sleep(time.Second)
+	})
+
+	var logged []string
+	start := time.Now()
+	beforeRestart(LogFunc(func(f string, a ...interface{}) { logged = append(logged, fmt.Sprintf(f, a...)) }), false)
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("took %s", took)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("context not cancelled")
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "shutdown timeout of 50ms reached while running OnExit function registered at cleanup_test.go:") {
+		t.Errorf("wrong log: %q", logged)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	oldTimeout := shutdownTimeout
+	defer func() {
+		onExit, shutdownTimeout = nil, oldTimeout
+	}()
+
+	// Set by Do().
+	for _, tt := range []struct {
+		opts []Option
+		want time.Duration
+	}{
+		{nil, defaultDrainTimeout},
+		{[]Option{Config{DrainTimeout: time.Second}}, time.Second},
+		{[]Option{Config{DrainTimeout: -1}}, -1},
+		{[]Option{Config{DrainTimeout: time.Second}, WithShutdownTimeout(time.Minute)}, time.Minute},
+	} {
+		go func() {
+			err := Do(nil, append(tt.opts, WithLogger(&testLogger{}), WithWatcher(newFakeWatcher()))...)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		for !running() {
+			time.Sleep(time.Millisecond)
+		}
+		Stop()
+		if shutdownTimeout != tt.want {
+			t.Errorf("shutdownTimeout is %s; want %s", shutdownTimeout, tt.want)
+		}
+	}
+
+	shutdownTimeout = 50 * time.Millisecond
+	var ran []string
+	OnExit(func() { ran = append(ran, "last") })
+	OnExit(func() { ran = append(ran, "second") })
+	OnExit(func() { time.Sleep(time.Second) })
+	OnExit(func() { ran = append(ran, "first") })
+
+	var logged []string
+	start := time.Now()
+	beforeRestart(LogFunc(func(f string, a ...interface{}) { logged = append(logged, fmt.Sprintf(f, a...)) }), false)
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("took %s", took)
+	}
+	if want := []string{"first"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("\nout:  %q\nwant: %q", ran, want)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "shutdown timeout of 50ms reached while running OnExit function registered at cleanup_test.go:") ||
+		!strings.Contains(logged[0], "without running the ones registered at cleanup_test.go:") {
+		t.Errorf("wrong log: %q", logged)
+	}
+}
+
+func TestOnBeforeRestart(t *testing.T) {
+	defer func() { onBeforeRestart = nil }()
+
+	var (
+		called  = make(chan string, 3)
+		blocked = make(chan struct{})
+		log     = LogFunc(func(string, ...interface{}) {})
+	)
+	defer close(blocked)
+	OnBeforeRestart(func(r string) { called <- "a " + r })
+	OnBeforeRestart(func(string) { panic("oops") })
+	notifyBeforeRestart(log, "manual restart")
+
+	onBeforeRestart = nil
+	OnBeforeRestart(func(r string) { called <- "b " + r; <-blocked })
+	start := time.Now()
+	notifyBeforeRestart(log, "manual restart")
+	if took := time.Since(start); took < beforeRestartTimeout || took > 2*beforeRestartTimeout {
+		t.Errorf("took %s", took)
+	}
+
+	var got []string
+	for len(called) > 0 {
+		got = append(got, <-called)
+	}
+	sort.Strings(got)
+	want := []string{"a manual restart", "b manual restart"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+type flushLogger struct {
+	LogFunc
+	flushed int
+}
+
+func (l *flushLogger) Flush() error { l.flushed++; return nil }
+
+func TestFlushOutput(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	var (
+		buf bytes.Buffer
+		w   = bufio.NewWriter(&buf)
+		l   = &flushLogger{LogFunc: log.Printf}
+	)
+	log.SetOutput(w)
+	log.Print("last line")
+
+	beforeRestart(l, false)
+	if l.flushed != 1 {
+		t.Errorf("logger flushed %d times", l.flushed)
+	}
+	if buf.String() == "" {
+		t.Error("log output not flushed")
+	}
+}
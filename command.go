@@ -0,0 +1,104 @@
+package reload
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WithPreRestartCommand runs a command before every restart, and only restarts
+// if it exits with code 0. This is useful to build the binary if you're
+// watching the source rather than the binary:
+//
+//    reload.Do(log.Printf,
+//        reload.Dir("./cmd/app", reload.Restart),
+//        reload.WithPreRestartCommand([]string{"make", "build"}, time.Minute))
+//
+// The command's output is logged. If it fails or doesn't
+// finish within the timeout (if not 0) then the old process keeps running.
+// Restarts triggered while the command runs are collapsed in to a single
+// re-run after it's finished.
+func WithPreRestartCommand(cmd []string, timeout time.Duration) Option {
+	return optionFunc(func(r *reloader) {
+		r.preRestart = cmd
+		r.preRestartTimeout = timeout
+	})
+}
+
+// BuildAndReload watches the source directories recursively, and runs the build
+// command when a .go file or go.mod changes. The process is restarted if the
+// build succeeds; the old process keeps running if it fails. The build's
+// output is logged.
+//
+//    reload.Do(log.Printf, reload.BuildAndReload(
+//        []string{"."}, []string{"go", "build", "-o", "/tmp/app", "."}))
+//
+// This is a shortcut for DirRecursive() with WithPreRestartCommand().
+func BuildAndReload(srcDirs []string, buildCmd []string) Option {
+	return optionFunc(func(r *reloader) {
+		for _, d := range srcDirs {
+			r.dirs = append(r.dirs, dir{path: d, cbFiles: restartOnSource, recursive: true})
+		}
+		WithPreRestartCommand(buildCmd, 0).apply(r)
+	})
+}
+
+func restartOnSource(changed []string) {
+	for _, c := range changed {
+		if filepath.Ext(c) == ".go" || filepath.Base(c) == "go.mod" {
+			Restart()
+			return
+		}
+	}
+}
+
+func runCommand(log Logger, cmd []string, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Use an *os.File rather than an io.Writer, as otherwise Wait() will wait
+	// for output from any background processes the command started.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer pr.Close()
+		s := bufio.NewScanner(pr)
+		for s.Scan() {
+			log.Infof("reload: %s: %s", cmd[0], s.Text())
+		}
+		io.Copy(ioutil.Discard, pr)
+	}()
+
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Stdout, c.Stderr = pw, pw
+	err = c.Run()
+	pw.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%q didn't finish in %s", strings.Join(cmd, " "), timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%q: %w", strings.Join(cmd, " "), err)
+	}
+	return nil
+}
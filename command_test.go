@@ -0,0 +1,88 @@
+//go:build !windows
+// +build !windows
+
+package reload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		cmd     string
+		timeout time.Duration
+		wantErr string
+		wantLog []string
+	}{
+		{"echo one; echo two", 0, "", []string{"reload: sh: one", "reload: sh: two"}},
+		{"echo err >&2; exit 2", 0, "exit status 2", []string{"reload: sh: err"}},
+		{"sleep 5", 50 * time.Millisecond, "didn't finish in 50ms", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			var logged []string
+			log := func(f string, a ...interface{}) { logged = append(logged, fmt.Sprintf(f, a...)) }
+
+			err := runCommand(LogFunc(log), []string{"sh", "-c", tt.cmd}, tt.timeout)
+			if !errorContains(err, tt.wantErr) {
+				t.Errorf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(logged, tt.wantLog) {
+				t.Errorf("wrong log\nout:  %q\nwant: %q", logged, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestBuildAndReload(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w         = newFakeWatcher()
+		restarted = make(chan Reason, 1)
+		ok        = filepath.Join(tmp, "ok")
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			WithRestart(func(r Reason) { restarted <- r }),
+			BuildAndReload([]string{tmp}, []string{"test", "-e", ok}))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	change := func(name string, want bool) {
+		t.Helper()
+		w.events <- WatchEvent{Name: filepath.Join(tmp, name), Op: OpCreate | OpWrite}
+		select {
+		case <-restarted:
+			if !want {
+				t.Fatalf("restarted after changing %q", name)
+			}
+		case <-time.After(500 * time.Millisecond):
+			if want {
+				t.Fatalf("not restarted after changing %q", name)
+			}
+		}
+	}
+
+	change("README", false)
+	change("main.go", false) // Build failed.
+	if err := ioutil.WriteFile(ok, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	change("main.go", true)
+}
@@ -0,0 +1,268 @@
+package reload
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Config holds less common settings; pass it to Do as an option.
+//
+// Zero fields are ignored, so it can be combined with other options.
+type Config struct {
+	// SuppressCallbacksAfterRestart ignores events for directories added with
+	// Dir() for this long after the binary changed, as the restart will take
+	// care of it. Ignored events are logged.
+	SuppressCallbacksAfterRestart time.Duration
+
+	// Restart is called to restart the process, e.g. to send a signal to a
+	// supervisor instead. If it returns an error it's logged and we keep
+	// watching for changes.
+	//
+	// The default is to call RestartExec, which calls Exec() and never returns.
+	// This is ignored if WithRestart() is used.
+	Restart func() error
+
+	// ExecAttempts is how many times Exec() tries to replace the process if it
+	// fails with ETXTBSY (file is still open for writing) or EAGAIN, spread out
+	// with an exponential backoff over ExecRetryWindow. The defaults are 5 and
+	// 2 seconds.
+	ExecAttempts    int
+	ExecRetryWindow time.Duration
+
+	// MaxDepth limits how deep DirRecursive() watches subdirectories; 1 means
+	// only direct subdirectories. The default of 0 means no limit.
+	MaxDepth int
+
+	// SkipDirs are directory names that DirRecursive() won't descend in to.
+	// The default is .git, .hg, .svn, node_modules, and vendor. Use an empty
+	// non-nil slice to not skip anything.
+	SkipDirs []string
+
+	// OnExitTimeout is how long every function registered with OnExit() may
+	// run before the restart continues without it. The default is 5 seconds.
+	OnExitTimeout time.Duration
+
+	// DrainTimeout limits how long everything before the process is replaced
+	// or exits may take in total: OnExit functions, WithKillChildren, and the
+	// shutdown function of GracefulUpgrade(). Once it's reached the context
+	// passed to OnExitContext functions is cancelled, the functions that
+	// didn't finish or run are logged, and the restart happens anyway.
+	//
+	// The default is 10 seconds; use a negative value for no limit other than
+	// the per-function OnExitTimeout.
+	DrainTimeout time.Duration
+
+	// ContinueOnAddError logs errors for directories added with Dir() that
+	// can't be watched (e.g. because they don't exist), instead of returning
+	// an error from Do(). The other directories are still watched.
+	ContinueOnAddError bool
+
+	// WaitForDirs allows directories added with Dir() that don't exist yet,
+	// such as a directory created by the first build. The closest parent that
+	// does exist is watched, and the directory is watched once it's created,
+	// at which point the callback is run.
+	WaitForDirs bool
+
+	// QuietErrors doesn't log errors if a callback was set with OnError().
+	QuietErrors bool
+
+	// ThrottleErrors logs identical consecutive errors from the watcher at
+	// most once per interval, starting at a second and doubling up to a
+	// minute every time it's logged again, with a count of the suppressed
+	// errors. The count is also logged when a different error comes in or
+	// Do() returns. They're still all sent to Errors() and OnError().
+	ThrottleErrors bool
+
+	// AsyncCallbacks runs the Dir() callbacks in a new goroutine, so that a
+	// slow callback doesn't hold up handling other changes. Only one callback
+	// runs at a time, but they're called from a different goroutine every
+	// time, so they need to be safe for that. A restart from a binary change
+	// waits for running callbacks to finish (see SettleWindow), and so does
+	// Do() before it returns. Batches that pile up behind a slow callback may
+	// run in any order.
+	//
+	// The default is to run them one after the other in the goroutine that
+	// watches for changes, which blocks everything else until they return.
+	AsyncCallbacks bool
+
+	// Repanic panics again after logging a panic in a Dir() callback or the
+	// restart function, which crashes the process. The default is to report
+	// it as a *PanicError and keep watching for changes.
+	Repanic bool
+
+	// Verbose logs every event from the watcher and what was done with it,
+	// like WithDebug(). Restarts and errors are always logged.
+	Verbose bool
+
+	// OnStart is called once all directories are watched, right before Do()
+	// starts waiting for changes. It gets the list of watched directories,
+	// which includes the binary's directory and subdirectories added with
+	// DirRecursive().
+	OnStart func(dirs []string)
+
+	// OnChange is called for every changed file right before the process is
+	// restarted or the callbacks are run for it, once the writes have
+	// settled. A file that changed more than once in a burst is reported once,
+	// with the last operation. It's not called for changes that are ignored,
+	// e.g. because of the TriggerOp, a Glob() pattern, or CheckModTime. It's
+	// called from the goroutine that watches for changes, so it should return
+	// quickly.
+	OnChange func(path string, op Op)
+
+	// TriggerOp is the filesystem operation that counts as a change. The
+	// default is OpWrite on Linux, and OpCreate on other systems. Setting
+	// this also silences the warning on systems that haven't been tested.
+	TriggerOp Op
+
+	// CanRestart is called before every restart; if it returns false the
+	// restart is postponed, and tried again every second or on the next
+	// change. This can be used to wait until e.g. a migration has finished.
+	CanRestart func() bool
+
+	// EventWriter gets every event from Events() as a JSON object on its own
+	// line, with the time, action, path, op, duration (in seconds), and error.
+	// Events are dropped if it can't keep up.
+	EventWriter io.Writer
+
+	// SkipUnchangedBinary doesn't restart if the binary is identical to the
+	// one that was running when Do() started, e.g. because it was touched or
+	// a reproducible build produced the same binary. This reads the entire
+	// binary on startup and every time it changes to compare the SHA-256.
+	//
+	// Restart() and WithSignal() always restart.
+	SkipUnchangedBinary bool
+
+	// SettleWindow is how long to wait for writes to the binary to finish
+	// before restarting; every change to the binary starts it again. Dir()
+	// callbacks for changes seen before it ends are run to completion first,
+	// without waiting for their directory to be quiet, so that e.g. a deploy
+	// that updates the binary and templates together restarts with the new
+	// templates in place. The default is 100ms.
+	//
+	// A callback that calls Exec() still restarts straight away.
+	SettleWindow time.Duration
+
+	// CheckModTime only restarts if the binary's modification time is newer
+	// than when it was last seen, to ignore duplicate events such as Create
+	// events that fire more than once on macOS.
+	CheckModTime bool
+
+	// IgnoreBinary doesn't watch the binary, so the process isn't restarted
+	// when it changes and only the Dir() callbacks are run. Restart() and
+	// WithSignal() still restart the process.
+	IgnoreBinary bool
+
+	// ResolveBinary returns the path of the binary to watch and restart,
+	// instead of the path the process was started as. This is useful if the
+	// running binary is a wrapper for the real application.
+	ResolveBinary func() (string, error)
+
+	// RestartStdin, RestartStdout, and RestartStderr are used as stdin,
+	// stdout, and stderr for the new process with SpawnAndExit() and
+	// GracefulUpgrade(), for example to send the output to a different log
+	// file. The default is the current process's.
+	//
+	// These are ignored by Exec(), as the new process replaces the current
+	// one and inherits all its file descriptors.
+	RestartStdin, RestartStdout, RestartStderr *os.File
+
+	// StartupGrace ignores changes for this long after Do() started, as a
+	// build may still be writing files right after a restart. Ignored events
+	// are logged.
+	//
+	// The default is 500ms, both for a fresh start and after a restart. There
+	// is no default with WithWatcher(), as those events don't come from the
+	// filesystem. Use a negative value to disable it.
+	StartupGrace time.Duration
+}
+
+func (c Config) apply(r *reloader) {
+	if c.SuppressCallbacksAfterRestart != 0 {
+		r.cfg.SuppressCallbacksAfterRestart = c.SuppressCallbacksAfterRestart
+	}
+	if c.Restart != nil {
+		r.cfg.Restart = c.Restart
+	}
+	if c.ExecAttempts != 0 {
+		r.cfg.ExecAttempts = c.ExecAttempts
+	}
+	if c.ExecRetryWindow != 0 {
+		r.cfg.ExecRetryWindow = c.ExecRetryWindow
+	}
+	if c.MaxDepth != 0 {
+		r.cfg.MaxDepth = c.MaxDepth
+	}
+	if c.SkipDirs != nil {
+		r.cfg.SkipDirs = c.SkipDirs
+	}
+	if c.OnExitTimeout != 0 {
+		r.cfg.OnExitTimeout = c.OnExitTimeout
+	}
+	if c.DrainTimeout != 0 {
+		r.cfg.DrainTimeout = c.DrainTimeout
+	}
+	if c.ContinueOnAddError {
+		r.cfg.ContinueOnAddError = true
+	}
+	if c.WaitForDirs {
+		r.cfg.WaitForDirs = true
+	}
+	if c.QuietErrors {
+		r.cfg.QuietErrors = true
+	}
+	if c.ThrottleErrors {
+		r.cfg.ThrottleErrors = true
+	}
+	if c.AsyncCallbacks {
+		r.cfg.AsyncCallbacks = true
+	}
+	if c.Repanic {
+		r.cfg.Repanic = true
+	}
+	if c.Verbose {
+		r.cfg.Verbose = true
+	}
+	if c.OnStart != nil {
+		r.cfg.OnStart = c.OnStart
+	}
+	if c.OnChange != nil {
+		r.cfg.OnChange = c.OnChange
+	}
+	if c.TriggerOp != 0 {
+		r.cfg.TriggerOp = c.TriggerOp
+	}
+	if c.CanRestart != nil {
+		r.cfg.CanRestart = c.CanRestart
+	}
+	if c.EventWriter != nil {
+		r.cfg.EventWriter = c.EventWriter
+	}
+	if c.SkipUnchangedBinary {
+		r.cfg.SkipUnchangedBinary = true
+	}
+	if c.SettleWindow != 0 {
+		r.cfg.SettleWindow = c.SettleWindow
+	}
+	if c.CheckModTime {
+		r.cfg.CheckModTime = true
+	}
+	if c.IgnoreBinary {
+		r.cfg.IgnoreBinary = true
+	}
+	if c.ResolveBinary != nil {
+		r.cfg.ResolveBinary = c.ResolveBinary
+	}
+	if c.RestartStdin != nil {
+		r.cfg.RestartStdin = c.RestartStdin
+	}
+	if c.RestartStdout != nil {
+		r.cfg.RestartStdout = c.RestartStdout
+	}
+	if c.RestartStderr != nil {
+		r.cfg.RestartStderr = c.RestartStderr
+	}
+	if c.StartupGrace != 0 {
+		r.cfg.StartupGrace = c.StartupGrace
+	}
+}
@@ -0,0 +1,48 @@
+package reload
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrRemoved is passed to the Content() callback if the file doesn't exist.
+var ErrRemoved = errors.New("reload: file was removed")
+
+// Content reads the file at path and calls cb with the contents when it
+// changes, for example to load a config file:
+//
+//    reload.Do(log.Printf, reload.Content("config.json", func(data []byte, err error) {
+//        if err != nil {
+//            log.Print(err)
+//            return
+//        }
+//        // Parse data.
+//    }))
+//
+// The callback is also called once when Do() starts, with the current
+// contents. The file is read once writes have settled, and replacing it by
+// renaming a new file over it is noticed. If the file is removed the callback
+// gets ErrRemoved; it's called again once the file is created.
+func Content(path string, cb func(data []byte, err error)) dir {
+	read := func([]Change) {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			err = ErrRemoved
+		}
+		cb(data, err)
+	}
+	return dir{path: filepath.Dir(path), file: path, cbChanges: read, content: true}
+}
+
+// ConfigFile calls cb when the file at path changes, without restarting the
+// process, for example to re-read the configuration. This is like passing a
+// file to Dir(), except that the file doesn't need to exist when Do() starts.
+//
+// Unlike Content() the callback isn't called when Do() starts, and the file
+// isn't read. Changes to the file never restart the process, even if it's in
+// the same directory as the binary.
+func ConfigFile(path string, cb func()) dir {
+	return dir{path: filepath.Dir(path), file: path, cb: cb}
+}
@@ -0,0 +1,259 @@
+package reload
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContent(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	file := filepath.Join(tmp, "config")
+	if err := ioutil.WriteFile(file, []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		data string
+		err  error
+	}
+	var (
+		w       = newFakeWatcher()
+		results = make(chan result, 4)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Content(file, func(data []byte, err error) { results <- result{string(data), err} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	next := func(want result) {
+		t.Helper()
+		select {
+		case got := <-results:
+			if got != want {
+				t.Errorf("got %v; want %v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("callback not called; want %v", want)
+		}
+	}
+	next(result{data: "one"})
+
+	if err := ioutil.WriteFile(file, []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "other"), Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: file, Op: OpWrite}
+	next(result{data: "two"})
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	w.events <- WatchEvent{Name: file, Op: OpRemove}
+	next(result{err: ErrRemoved})
+
+	// Renamed over it.
+	if err := ioutil.WriteFile(file, []byte("three"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.events <- WatchEvent{Name: file, Op: OpCreate}
+	next(result{data: "three"})
+
+	select {
+	case r := <-results:
+		t.Errorf("callback called again: %v", r)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestContentAtomicSave(t *testing.T) {
+	tests := []struct {
+		name   string
+		save   func(file string) error
+		events func(file string) []WatchEvent
+	}{
+		{"vim", func(file string) error {
+			if err := os.Rename(file, file+"~"); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(file, []byte("new"), 0o644); err != nil {
+				return err
+			}
+			return os.Remove(file + "~")
+		}, func(file string) []WatchEvent {
+			return []WatchEvent{
+				{Name: file, Op: OpRename},
+				{Name: file + "~", Op: OpCreate},
+				{Name: file, Op: OpCreate},
+				{Name: file, Op: OpWrite},
+				{Name: file + "~", Op: OpRemove},
+			}
+		}},
+		{"rename", func(file string) error {
+			if err := ioutil.WriteFile(file+".tmp", []byte("new"), 0o644); err != nil {
+				return err
+			}
+			return os.Rename(file+".tmp", file)
+		}, func(file string) []WatchEvent {
+			return []WatchEvent{
+				{Name: file + ".tmp", Op: OpCreate},
+				{Name: file + ".tmp", Op: OpWrite},
+				{Name: file + ".tmp", Op: OpRename},
+				{Name: file, Op: OpCreate},
+			}
+		}},
+		{"remove and create", func(file string) error {
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+			return ioutil.WriteFile(file, []byte("new"), 0o644)
+		}, func(file string) []WatchEvent {
+			return []WatchEvent{
+				{Name: file, Op: OpRemove},
+				{Name: file, Op: OpCreate},
+				{Name: file, Op: OpWrite},
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "reload")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			file := filepath.Join(tmp, "config")
+			if err := ioutil.WriteFile(file, []byte("old"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				w       = newFakeWatcher()
+				results = make(chan string, 4)
+				called  = make(chan struct{}, 4)
+				done    = make(chan struct{})
+			)
+			go func() {
+				defer close(done)
+				err := Do(log.Printf, WithWatcher(w),
+					Dir(file, func() { called <- struct{}{} }),
+					Content(file, func(data []byte, err error) {
+						if err != nil {
+							results <- err.Error()
+							return
+						}
+						results <- string(data)
+					}))
+				if err != nil {
+					panic(err)
+				}
+			}()
+			defer func() { Stop(); <-done }()
+
+			if r := <-results; r != "old" {
+				t.Fatalf("initial contents: %q", r)
+			}
+			if err := tt.save(file); err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range tt.events(file) {
+				w.events <- e
+			}
+
+			select {
+			case r := <-results:
+				if r != "new" {
+					t.Errorf("got %q", r)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Content callback not called")
+			}
+			select {
+			case <-called:
+			case <-time.After(time.Second):
+				t.Fatal("Dir callback not called")
+			}
+			select {
+			case r := <-results:
+				t.Errorf("Content callback called again: %q", r)
+			case <-called:
+				t.Error("Dir callback called again")
+			case <-time.After(200 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(tmp, "app")
+	if err := ioutil.WriteFile(app, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(tmp, "config.toml") // Created later.
+
+	oldSelf, oldLaunch := binSelf, binLaunch
+	defer func() { binSelf, binLaunch = oldSelf, oldLaunch }()
+
+	var (
+		w         = newFakeWatcher()
+		called    = make(chan struct{}, 2)
+		restarted = make(chan struct{}, 2)
+		started   = make(chan struct{})
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Config{
+				OnStart:       func([]string) { close(started) },
+				ResolveBinary: func() (string, error) { return app, nil },
+			},
+			WithRestart(func(Reason) { restarted <- struct{}{} }),
+			ConfigFile(file, func() { called <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	<-started
+
+	select {
+	case <-called:
+		t.Fatal("called on startup")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "other"), Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: file, Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not called")
+	}
+	select {
+	case <-called:
+		t.Error("callback called twice")
+	case <-restarted:
+		t.Error("restarted")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
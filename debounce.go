@@ -0,0 +1,19 @@
+package reload
+
+import "time"
+
+// Default for Debounce().
+const defaultDebounce = 100 * time.Millisecond
+
+// Debounce sets how long the directory must be quiet before the callback from
+// d is run, instead of the default 100ms. For example to re-read the
+// configuration only once a deploy has finished writing all of it:
+//
+//    reload.Debounce(time.Second, reload.Dir("config", reloadFlags))
+//
+// Every callback for a path has its own quiet period; callbacks with the same
+// period are run together in the order they were added.
+func Debounce(wait time.Duration, d dir) dir {
+	d.debounce = wait
+	return d
+}
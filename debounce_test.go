@@ -0,0 +1,55 @@
+package reload
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w     = newFakeWatcher()
+		fast  = make(chan struct{}, 4)
+		files = make(chan []string, 2)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Dir(tmp, func() { fast <- struct{}{} }),
+			Debounce(500*time.Millisecond, DirFiles(tmp, func(f []string) { files <- f })))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	a, b := filepath.Join(tmp, "a"), filepath.Join(tmp, "b")
+	for _, p := range []string{a, b} {
+		w.events <- WatchEvent{Name: p, Op: OpCreate | OpWrite}
+		select {
+		case <-fast:
+		case <-time.After(time.Second):
+			t.Fatalf("Dir callback not run for %q", p)
+		}
+		if len(files) > 0 {
+			t.Fatalf("Debounce callback run early: %q", <-files)
+		}
+	}
+	select {
+	case f := <-files:
+		if want := []string{a, b}; !reflect.DeepEqual(f, want) {
+			t.Errorf("\ngot:  %q\nwant: %q", f, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Debounce callback not run")
+	}
+}
@@ -0,0 +1,41 @@
+package reload
+
+import "sync"
+
+// Set by WithDryRun() and SetDryRun().
+var (
+	dryRunMu        sync.Mutex
+	dryRun          bool
+	dryRunCallbacks bool
+)
+
+// WithDryRun logs what would happen instead of restarting the process, which
+// is useful to see what reload does when first adding it to a service. Events
+// go through the same filtering and delays, but commands from
+// WithPreRestartCommand() aren't run either.
+//
+// Dir() callbacks are still run if runCallbacks is true, as they're usually
+// harmless; otherwise they're logged as well.
+//
+// Use SetDryRun() to change it while Do() is running.
+func WithDryRun(runCallbacks bool) Option {
+	return optionFunc(func(r *reloader) {
+		r.dryRun = true
+		r.dryRunCallbacks = runCallbacks
+	})
+}
+
+// SetDryRun enables or disables the dry-run mode from WithDryRun(); this can
+// be called at any time, for example from an admin endpoint.
+func SetDryRun(enabled bool) {
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	dryRun = enabled
+}
+
+// Report if we're in dry-run mode, and if callbacks should run.
+func isDryRun() (dry, callbacks bool) {
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	return dryRun, dryRunCallbacks
+}
@@ -0,0 +1,69 @@
+package reload
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		l         = &testLogger{}
+		w         = newFakeWatcher()
+		called    = make(chan struct{}, 1)
+		restarted = make(chan struct{}, 1)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithDryRun(false),
+			Dir(tmp, func() { called <- struct{}{} }),
+			WithRestart(func(Reason) { restarted <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "file"), Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: dry-run: would run callback for dir=")
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: dry-run: would restart (path=")
+	select {
+	case <-called:
+		t.Error("callback run")
+	case <-restarted:
+		t.Error("restarted")
+	default:
+	}
+
+	SetDryRun(false)
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted after SetDryRun(false)")
+	}
+
+	// Should be reset on the next Do().
+	SetDryRun(true)
+	Stop()
+	l = &testLogger{}
+	go func() {
+		if err := Do(nil, WithLogger(l), WithWatcher(newFakeWatcher())); err != nil {
+			panic(err)
+		}
+	}()
+	l.wait(t, "INFO restarting")
+	if dry, _ := isDryRun(); dry {
+		t.Error("still in dry-run mode after Do() without WithDryRun()")
+	}
+}
@@ -0,0 +1,35 @@
+package reload
+
+import "sync"
+
+var (
+	disabledMu sync.Mutex
+	disabled   bool
+)
+
+// Disable stops restarting the process and running Dir() callbacks until
+// Enable() is called, for example during maintenance. Events are still read
+// from the watcher, but are ignored; they're not replayed on Enable().
+//
+// A restart that was already postponed (e.g. by WithRestartWindow()) is held
+// until Enable() is called. Restart() and signals from WithSignal() still
+// restart the process.
+func Disable() {
+	disabledMu.Lock()
+	defer disabledMu.Unlock()
+	disabled = true
+}
+
+// Enable undoes Disable().
+func Enable() {
+	disabledMu.Lock()
+	defer disabledMu.Unlock()
+	disabled = false
+}
+
+// Enabled reports if reload is enabled; it's only disabled after Disable().
+func Enabled() bool {
+	disabledMu.Lock()
+	defer disabledMu.Unlock()
+	return !disabled
+}
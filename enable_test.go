@@ -0,0 +1,117 @@
+package reload
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDisable(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer Enable()
+
+	var (
+		w         = newFakeWatcher()
+		called    = make(chan struct{}, 2)
+		restarted = make(chan struct{}, 2)
+		started   = make(chan struct{})
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Dir(tmp, func() { called <- struct{}{} }),
+			WithRestart(func(Reason) { restarted <- struct{}{} }),
+			Config{OnStart: func([]string) { close(started) }})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	<-started
+
+	Disable()
+	if Enabled() {
+		t.Fatal("Enabled() after Disable()")
+	}
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "file"), Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+		t.Error("callback run while disabled")
+	case <-restarted:
+		t.Error("restarted while disabled")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Nothing is replayed.
+	Enable()
+	select {
+	case <-called:
+		t.Error("callback run for event from while disabled")
+	case <-restarted:
+		t.Error("restarted for event from while disabled")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted after Enable()")
+	}
+}
+
+// A restart that's already postponed isn't run while disabled.
+func TestDisablePostponed(t *testing.T) {
+	defer Enable()
+	oldInterval := canRestartInterval
+	defer func() { canRestartInterval = oldInterval }()
+	canRestartInterval = 50 * time.Millisecond
+
+	// It's 11:59:58 in this zone, so the window opens in 2 seconds.
+	now := time.Now()
+	loc := time.FixedZone("test", 12*3600-2-int(now.Unix()%86400))
+
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		restarted = make(chan struct{}, 2)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(Reason) { restarted <- struct{}{} }),
+			WithRestartWindow(loc, "12:00-12:10"))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: not restarting yet, as it's outside the restart window")
+	Disable()
+
+	select {
+	case <-restarted:
+		t.Fatal("restarted while disabled")
+	case <-time.After(time.Until(now.Add(2500 * time.Millisecond))):
+	}
+	if ok, p := Pending(); !ok || p.Policy != HeldByDisabled {
+		t.Errorf("wrong pending: %v %#v", ok, p)
+	}
+
+	Enable()
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted after Enable()")
+	}
+}
@@ -0,0 +1,178 @@
+package reload
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// Runtime errors for Errors().
+	errs = make(chan error, 16)
+
+	onErrorMu sync.Mutex
+	onError   func(error)
+
+	// Don't log errors if there's an OnError callback, set by Do().
+	quietErrors bool
+)
+
+// Errors returns a channel with errors that occur after Do() is initialized,
+// such as errors from the watcher or a failed restart. These are also sent to
+// the log function.
+//
+// The channel is buffered; errors are dropped if it's full, so you don't need
+// to read from it if you're not interested.
+func Errors() <-chan error { return errs }
+
+// OnError sets a function to call for every error that occurs after Do() is
+// initialized, for example to send them to an error reporting service. Errors
+// are also still logged, unless Config.QuietErrors is set.
+//
+// The errors are a *WatchError, *RestartError, or *PanicError where
+// possible. The function is called from the goroutine that watches for
+// changes, so it should return quickly.
+func OnError(fn func(err error)) {
+	onErrorMu.Lock()
+	defer onErrorMu.Unlock()
+	onError = fn
+}
+
+// WatchError is reported when a directory can't be watched, or when the
+// watcher reports an error.
+type WatchError struct {
+	Path string // Directory that failed; empty for errors from the watcher.
+	Err  error
+}
+
+func (e *WatchError) Error() string { return e.Err.Error() }
+func (e *WatchError) Unwrap() error { return e.Err }
+
+// RestartError is reported when the process can't be restarted; the old
+// process keeps running.
+type RestartError struct{ Err error }
+
+func (e *RestartError) Error() string { return e.Err.Error() }
+func (e *RestartError) Unwrap() error { return e.Err }
+
+// Log and send an error to the Errors() channel and OnError callback.
+func logError(log Logger, err error) {
+	fn := errorFunc()
+	if fn == nil || !quietErrors {
+		if s, ok := log.(structuredLogger); ok {
+			s.error("error", "err", err)
+		} else {
+			log.Errorf("reload error: %v", err)
+		}
+	}
+	sendError(fn, err)
+}
+
+// Log and send an error from the watcher. If t isn't nil identical errors
+// aren't logged more than once per interval; they're still sent to Errors()
+// and OnError.
+func logWatchError(log Logger, err error, t *errorThrottle) {
+	var suppressed int
+	if t != nil {
+		if err.Error() != t.last {
+			t.flush(log)
+		}
+		var ok bool
+		if ok, suppressed = t.allow(err.Error()); !ok {
+			sendError(errorFunc(), &WatchError{Err: err})
+			return
+		}
+	}
+
+	err = &WatchError{Err: err}
+	fn := errorFunc()
+	if fn == nil || !quietErrors {
+		writeWatchError(log, err, suppressed)
+	}
+	sendError(fn, err)
+}
+
+func writeWatchError(log Logger, err error, suppressed int) {
+	if s, ok := log.(structuredLogger); ok {
+		if suppressed > 0 {
+			s.error("watch error", "err", err, "suppressed", suppressed)
+		} else {
+			s.error("watch error", "err", err)
+		}
+	} else if suppressed > 0 {
+		log.Errorf("reload error: %v (%d identical errors suppressed)", err, suppressed)
+	} else {
+		log.Errorf("reload error: %v", err)
+	}
+}
+
+// Throttle logging identical consecutive errors, with the interval doubling
+// every time the same error is logged again; see Config.ThrottleErrors.
+type errorThrottle struct {
+	now        func() time.Time
+	last       string
+	next       time.Time
+	wait       time.Duration
+	suppressed int
+}
+
+const (
+	throttleMin = time.Second
+	throttleMax = time.Minute
+)
+
+func newErrorThrottle() *errorThrottle { return &errorThrottle{now: time.Now} }
+
+// Report if the error message should be logged, and how many identical errors
+// were suppressed since it was last logged.
+func (t *errorThrottle) allow(msg string) (bool, int) {
+	now := t.now()
+	if msg != t.last {
+		t.last, t.wait, t.suppressed = msg, throttleMin, 0
+		t.next = now.Add(t.wait)
+		return true, 0
+	}
+	if now.Before(t.next) {
+		t.suppressed++
+		return false, 0
+	}
+
+	n := t.suppressed
+	t.suppressed = 0
+	if t.wait *= 2; t.wait > throttleMax {
+		t.wait = throttleMax
+	}
+	t.next = now.Add(t.wait)
+	return true, n
+}
+
+// Log the count of errors suppressed since the last one was logged, if any;
+// this is done when a different error comes in and when Do() returns, as the
+// count would be lost otherwise.
+func (t *errorThrottle) flush(log Logger) {
+	if t == nil || t.suppressed == 0 {
+		return
+	}
+	if errorFunc() == nil || !quietErrors {
+		writeWatchError(log, &WatchError{Err: errors.New(t.last)}, t.suppressed)
+	}
+	t.suppressed = 0
+}
+
+func errorFunc() func(error) {
+	onErrorMu.Lock()
+	defer onErrorMu.Unlock()
+	return onError
+}
+
+func sendError(fn func(error), err error) {
+	recorder.Error(err)
+	sendEvent(Event{Kind: Error, Err: err})
+	if fn != nil {
+		fn(err)
+	}
+	select {
+	case errs <- err:
+	default:
+	}
+}
@@ -0,0 +1,163 @@
+package reload
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	for len(errs) > 0 {
+		<-errs
+	}
+
+	var logged int
+	log := func(string, ...interface{}) { logged++ }
+	for i := 0; i < cap(errs)+5; i++ {
+		logError(LogFunc(log), errors.New("oops"))
+	}
+
+	if logged != cap(errs)+5 {
+		t.Errorf("logged %d errors", logged)
+	}
+	if len(errs) != cap(errs) {
+		t.Errorf("len(errs) = %d", len(errs))
+	}
+	if err := <-Errors(); err.Error() != "oops" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestOnError(t *testing.T) {
+	defer func() { OnError(nil); quietErrors = false }()
+	for len(errs) > 0 {
+		<-errs
+	}
+
+	var (
+		logged int
+		got    []error
+	)
+	log := LogFunc(func(string, ...interface{}) { logged++ })
+	OnError(func(err error) { got = append(got, err) })
+
+	logWatchError(log, errors.New("watcher broke"), nil)
+	logError(log, &RestartError{Err: errors.New("exec failed")})
+	if logged != 2 || len(got) != 2 {
+		t.Fatalf("logged %d, callback called %d times", logged, len(got))
+	}
+
+	var (
+		watchErr   *WatchError
+		restartErr *RestartError
+	)
+	if !errors.As(got[0], &watchErr) || watchErr.Error() != "watcher broke" {
+		t.Errorf("wrong error: %#v", got[0])
+	}
+	if !errors.As(got[1], &restartErr) {
+		t.Errorf("wrong error: %#v", got[1])
+	}
+
+	quietErrors = true
+	logError(log, errors.New("oops"))
+	if logged != 2 || len(got) != 3 {
+		t.Errorf("logged %d, callback called %d times", logged, len(got))
+	}
+	if len(errs) != 3 {
+		t.Errorf("len(errs) = %d", len(errs))
+	}
+}
+
+func TestErrorThrottle(t *testing.T) {
+	var (
+		now   = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		th    = &errorThrottle{now: func() time.Time { return now }}
+		tests = []struct {
+			after      time.Duration
+			msg        string
+			want       bool
+			suppressed int
+		}{
+			{0, "a", true, 0},
+			{0, "a", false, 0},
+			{500 * time.Millisecond, "a", false, 0},
+			{500 * time.Millisecond, "a", true, 2}, // After 1s.
+			{time.Second, "a", false, 0},
+			{time.Second, "a", true, 1}, // After 2s.
+			{3 * time.Second, "a", false, 0},
+			{time.Second, "a", true, 1}, // After 4s.
+			{0, "b", true, 0},           // Different error resets it.
+			{0, "b", false, 0},
+			{0, "a", true, 0},
+		}
+	)
+
+	for i, tt := range tests {
+		now = now.Add(tt.after)
+		got, n := th.allow(tt.msg)
+		if got != tt.want || n != tt.suppressed {
+			t.Errorf("%d: got %t, %d; want %t, %d", i, got, n, tt.want, tt.suppressed)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		now = now.Add(time.Hour)
+		th.allow("a")
+	}
+	if th.wait != throttleMax {
+		t.Errorf("wait = %s", th.wait)
+	}
+}
+
+func TestThrottleErrors(t *testing.T) {
+	for len(errs) > 0 {
+		<-errs
+	}
+
+	var (
+		l  = new(testLogger)
+		th = newErrorThrottle()
+	)
+	for i := 0; i < 5; i++ {
+		logWatchError(l, errors.New("storm"), th)
+	}
+	th.next = time.Time{}
+	logWatchError(l, errors.New("storm"), th)
+
+	want := []string{
+		"ERROR reload error: storm",
+		"ERROR reload error: storm (4 identical errors suppressed)",
+	}
+	if got := l.lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	if len(errs) != 6 {
+		t.Errorf("len(errs) = %d", len(errs))
+	}
+}
+
+// The count isn't lost if a different error comes in.
+func TestThrottleErrorsChanged(t *testing.T) {
+	defer func() {
+		for len(errs) > 0 {
+			<-errs
+		}
+	}()
+
+	var (
+		l  = new(testLogger)
+		th = newErrorThrottle()
+	)
+	for _, e := range []string{"a", "a", "a", "b"} {
+		logWatchError(l, errors.New(e), th)
+	}
+	want := []string{
+		"ERROR reload error: a",
+		"ERROR reload error: a (2 identical errors suppressed)",
+		"ERROR reload error: b",
+	}
+	if got := l.lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
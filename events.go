@@ -0,0 +1,154 @@
+package reload
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+// Event kinds.
+const (
+	BinaryChange     EventKind = iota + 1 // The binary changed.
+	DirChange                             // A file in a Dir() changed.
+	RestartScheduled                      // The process is about to restart.
+	CallbackRan                           // A Dir() callback returned.
+	Error                                 // An error was sent to Errors().
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case BinaryChange:
+		return "binary change"
+	case DirChange:
+		return "dir change"
+	case RestartScheduled:
+		return "restart scheduled"
+	case CallbackRan:
+		return "callback ran"
+	case Error:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is something that happened in Do(); see Events().
+type Event struct {
+	Time     time.Time
+	Kind     EventKind
+	Path     string        // Changed file, or the directory for CallbackRan.
+	Op       Op            // Only for BinaryChange and DirChange.
+	Duration time.Duration // How long the callback ran, for CallbackRan.
+	Err      error         // Only for Error.
+}
+
+var (
+	eventsMu     sync.Mutex
+	events       = make(chan Event, 64)
+	eventsClosed bool
+
+	// Events for Config.EventWriter; nil if it's not set.
+	eventWriter        chan Event
+	eventWriterDropped bool
+)
+
+// Events returns a channel with what's happening in Do(), for example to show
+// a notification when templates were reloaded. This is only informational;
+// it doesn't matter for restarts if this is read from or not.
+//
+// The channel is buffered; events are dropped (and counted in Stats()) if
+// it's full. It's closed when the watcher is closed, and Do() will make a new
+// channel if it's started again.
+func Events() <-chan Event {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	return events
+}
+
+func sendEvent(e Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if eventsClosed {
+		return
+	}
+	e.Time = time.Now()
+	broadcastSSE(e)
+	select {
+	case events <- e:
+	default:
+		countStats(func(s *Statistics) { s.EventsDropped++ })
+	}
+
+	if eventWriter != nil {
+		select {
+		case eventWriter <- e:
+			eventWriterDropped = false
+		default:
+			if !eventWriterDropped {
+				logger.Errorf("reload: Config.EventWriter is too slow; dropping events")
+				eventWriterDropped = true
+			}
+		}
+	}
+}
+
+// Write events to w as JSON until the returned function is called.
+func startEventWriter(w io.Writer) (stop func()) {
+	ch, done := make(chan Event, 64), make(chan struct{})
+	eventsMu.Lock()
+	eventWriter, eventWriterDropped = ch, false
+	eventsMu.Unlock()
+
+	go func() {
+		defer close(done)
+		enc := json.NewEncoder(w)
+		for e := range ch {
+			j := struct {
+				Time     time.Time `json:"time"`
+				Action   string    `json:"action"`
+				Path     string    `json:"path,omitempty"`
+				Op       string    `json:"op,omitempty"`
+				Duration float64   `json:"duration,omitempty"` // In seconds.
+				Err      string    `json:"error,omitempty"`
+			}{Time: e.Time, Action: e.Kind.String(), Path: e.Path, Duration: e.Duration.Seconds()}
+			if e.Op != 0 {
+				j.Op = e.Op.String()
+			}
+			if e.Err != nil {
+				j.Err = e.Err.Error()
+			}
+			// Not much we can do about errors, and logging them would
+			// probably be noisy.
+			_ = enc.Encode(j)
+		}
+	}()
+
+	return func() {
+		eventsMu.Lock()
+		eventWriter = nil
+		eventsMu.Unlock()
+		close(ch)
+		<-done
+	}
+}
+
+func openEvents() {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if eventsClosed {
+		events, eventsClosed = make(chan Event, 64), false
+	}
+}
+
+func closeEvents() {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if !eventsClosed {
+		close(events)
+		eventsClosed = true
+	}
+}
@@ -0,0 +1,130 @@
+package reload
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for len(Events()) > 0 {
+		<-Events()
+	}
+
+	var (
+		w         = newFakeWatcher()
+		started   = make(chan struct{})
+		restarted = make(chan struct{}, 1)
+		called    = make(chan struct{}, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), Dir(tmp, func() { called <- struct{}{} }),
+			WithRestart(func(Reason) { restarted <- struct{}{} }),
+			Config{OnStart: func([]string) { close(started) }})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	<-started
+	ch := Events()
+
+	file := filepath.Join(tmp, "file")
+	w.events <- WatchEvent{Name: file, Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	select {
+	case <-restarted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not restarted")
+	}
+	Stop()
+
+	var got []string
+	for e := range ch {
+		if e.Time.IsZero() {
+			t.Errorf("no time for %v", e)
+		}
+		got = append(got, e.Kind.String()+" "+e.Path)
+	}
+	want := []string{
+		"dir change " + file,
+		"callback ran " + tmp,
+		"binary change " + launch,
+		"restart scheduled " + launch,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestEventWriter(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		buf    bytes.Buffer
+		w      = newFakeWatcher()
+		called = make(chan struct{}, 1)
+		ret    = make(chan error, 1)
+		file   = filepath.Join(tmp, "file")
+	)
+	go func() {
+		ret <- Do(log.Printf, WithWatcher(w), Config{EventWriter: &buf},
+			Dir(tmp, func() { called <- struct{}{} }))
+	}()
+
+	w.events <- WatchEvent{Name: file, Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	// Stop() waits for everything to be written.
+	Stop()
+	if err := <-ret; err != nil {
+		t.Fatal(err)
+	}
+
+	var got []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e map[string]interface{}
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, e["time"].(string)); err != nil {
+			t.Error(err)
+		}
+		delete(e, "time")
+		got = append(got, e)
+	}
+	if len(got) != 2 {
+		t.Fatalf("wrong number of events: %v", got)
+	}
+	if want := map[string]interface{}{"action": "dir change", "path": file, "op": "CREATE|WRITE"}; !reflect.DeepEqual(got[0], want) {
+		t.Errorf("\ngot:  %v\nwant: %v", got[0], want)
+	}
+	if got[1]["action"] != "callback ran" || got[1]["path"] != tmp || got[1]["duration"] == nil {
+		t.Errorf("wrong callback event: %v", got[1])
+	}
+}
@@ -14,7 +14,7 @@ func main() {
 			reload.Dir("/tmp", func() { log.Printf("/tmp changed") }),
 			reload.Dir(".", reload.Exec))
 		if err != nil {
-			panic(err)
+			log.Print(err)
 		}
 	}()
 
@@ -0,0 +1,28 @@
+package reload
+
+import "os"
+
+// ExitAndLetSupervisorRestart returns a restart function for Config.Restart
+// which exits with the given exit code, for when a supervisor such as systemd
+// (with Restart=always) or Kubernetes will start the process again:
+//
+//    reload.Do(log.Printf, reload.Config{Restart: reload.ExitAndLetSupervisorRestart(3)})
+//
+// The OnExit functions and WithKillChildren are run first, like with Exec().
+//
+// Prefer this over Exec() if something else is responsible for starting the
+// process: replacing the process in-place keeps the PID, so the supervisor
+// doesn't know the process was restarted, and restart limits, logs, and health
+// checks are bypassed. Use Exec() if there is no supervisor, or it doesn't
+// restart processes that exit.
+func ExitAndLetSupervisorRestart(code int) func() error {
+	return func() error {
+		logger.Infof("reload: exiting with code %d to be restarted by the supervisor", code)
+		beforeRestart(logger, true)
+		if closeWatcher != nil {
+			closeWatcher()
+		}
+		os.Exit(code)
+		return nil
+	}
+}
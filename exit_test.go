@@ -0,0 +1,29 @@
+package reload
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExitAndLetSupervisorRestart(t *testing.T) {
+	if os.Getenv("RELOAD_TEST_EXIT") == "1" {
+		OnExit(func() { os.Stdout.WriteString("on exit\n") })
+		ExitAndLetSupervisorRestart(3)()
+		t.Fatal("didn't exit")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExitAndLetSupervisorRestart$")
+	cmd.Env = append(os.Environ(), "RELOAD_TEST_EXIT=1")
+	out, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("wrong exit: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "on exit\n") {
+		t.Errorf("OnExit function not run:\n%s", out)
+	}
+}
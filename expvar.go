@@ -0,0 +1,39 @@
+package reload
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// WithExpvar publishes the counters from Stats() in an expvar.Map named
+// "reload":
+//
+//    restarts            number of restarts, including those by Exec() in
+//                        previous processes
+//    last_restart_time   when the last restart was started (RFC 3339)
+//    dir_callbacks       number of callback calls for every Dir()
+//    watcher_errors      number of errors from the watcher
+//    events_seen         number of filesystem events
+//
+// The map is published once and shared by all calls to Do().
+func WithExpvar() Option {
+	return optionFunc(func(*reloader) { publishOnce.Do(publishExpvar) })
+}
+
+// expvar.Publish() panics if a name is used twice, so only do it once.
+var publishOnce sync.Once
+
+func publishExpvar() {
+	m := expvar.NewMap("reload")
+	m.Set("restarts", expvar.Func(func() interface{} { return Stats().Restarts }))
+	m.Set("last_restart_time", expvar.Func(func() interface{} {
+		if t := Stats().LastRestart; !t.IsZero() {
+			return t.Format(time.RFC3339)
+		}
+		return ""
+	}))
+	m.Set("dir_callbacks", expvar.Func(func() interface{} { return Stats().DirCallbacks }))
+	m.Set("watcher_errors", expvar.Func(func() interface{} { return Stats().WatcherErrors }))
+	m.Set("events_seen", expvar.Func(func() interface{} { return Stats().EventsSeen }))
+}
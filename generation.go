@@ -0,0 +1,60 @@
+package reload
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables set by Exec to let the new process know it was
+// restarted.
+const (
+	envGeneration = "RELOAD_GENERATION"
+	envStartedAt  = "RELOAD_STARTED_AT"
+	envListeners  = "RELOAD_LISTENERS"
+	envReadyFD    = "RELOAD_READY_FD"
+)
+
+// WasReloaded reports if this process was started by Exec, rather than being a
+// fresh start.
+func WasReloaded() bool { return Generation() > 0 }
+
+// Generation reports how many times this process was restarted by Exec; this
+// is 0 for a fresh start.
+func Generation() int {
+	n, err := strconv.Atoi(os.Getenv(envGeneration))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// LastReload reports when the previous process called Exec to start this
+// one. It returns false if this process wasn't started by Exec.
+func LastReload() (time.Time, bool) {
+	ns, err := strconv.ParseInt(os.Getenv(envStartedAt), 10, 64)
+	if err != nil || !WasReloaded() {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
+// execEnv gets the environment for the next process, with the generation
+// incremented. Any internal RELOAD_* variables are removed, and extra is
+// appended.
+func execEnv(extra ...string) []string {
+	env := make([]string, 0, len(os.Environ())+len(extra)+2)
+	for _, e := range os.Environ() {
+		k := e[:strings.IndexByte(e+"=", '=')]
+		switch k {
+		case envGeneration, envStartedAt, envListeners, envReadyFD:
+			continue
+		}
+		env = append(env, e)
+	}
+	env = append(env,
+		envGeneration+"="+strconv.Itoa(Generation()+1),
+		envStartedAt+"="+strconv.FormatInt(time.Now().UnixNano(), 10))
+	return append(env, extra...)
+}
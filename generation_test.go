@@ -0,0 +1,51 @@
+package reload
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeneration(t *testing.T) {
+	defer os.Unsetenv(envGeneration)
+
+	os.Unsetenv(envGeneration)
+	if WasReloaded() || Generation() != 0 {
+		t.Fatalf("fresh start: %v %d", WasReloaded(), Generation())
+	}
+
+	os.Setenv(envGeneration, "2")
+	if !WasReloaded() || Generation() != 2 {
+		t.Fatalf("reloaded: %v %d", WasReloaded(), Generation())
+	}
+
+	var gen []string
+	for _, e := range execEnv() {
+		if strings.HasPrefix(e, envGeneration+"=") {
+			gen = append(gen, e)
+		}
+	}
+	if len(gen) != 1 || gen[0] != envGeneration+"=3" {
+		t.Fatalf("execEnv: %v", gen)
+	}
+}
+
+func TestLastReload(t *testing.T) {
+	defer os.Unsetenv(envGeneration)
+	defer os.Unsetenv(envStartedAt)
+
+	os.Unsetenv(envGeneration)
+	os.Unsetenv(envStartedAt)
+	if r, ok := LastReload(); ok || !r.IsZero() {
+		t.Fatalf("fresh start: %v %v", r, ok)
+	}
+
+	now := time.Now()
+	os.Setenv(envGeneration, "1")
+	os.Setenv(envStartedAt, strconv.FormatInt(now.UnixNano(), 10))
+	if r, ok := LastReload(); !ok || !r.Equal(now) {
+		t.Fatalf("reloaded: %v %v; want %v", r, ok, now)
+	}
+}
@@ -0,0 +1,88 @@
+package reload
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Glob is like Dir, but the callback is only run for files matching the
+// pattern, such as "templates/*.tmpl". A "**" path element matches any number
+// of directories, as in "templates/**/*.tmpl".
+//
+// The directory before the first element with a wildcard is watched; it's
+// watched recursively (like DirRecursive) if any directory in the pattern has
+// a wildcard, so new matching files are picked up in new directories too.
+func Glob(pattern string, cb func()) dir {
+	pattern = filepath.Clean(pattern)
+	base := globBase(pattern)
+	return dir{path: base, pattern: pattern, cb: cb, recursive: base != filepath.Dir(pattern)}
+}
+
+// Get the leading directories of pattern that don't have any wildcards.
+func globBase(pattern string) string {
+	parts := strings.Split(pattern, string(filepath.Separator))
+	for i, p := range parts {
+		if hasMeta(p) {
+			base := strings.Join(parts[:i], string(filepath.Separator))
+			if base == "" && i > 0 {
+				return string(filepath.Separator)
+			}
+			if base == "" {
+				return "."
+			}
+			return base
+		}
+	}
+	return filepath.Dir(pattern)
+}
+
+func hasMeta(p string) bool {
+	magic := `*?[`
+	if filepath.Separator != '\\' {
+		magic = `*?[\`
+	}
+	return strings.ContainsAny(p, magic)
+}
+
+// Check that pattern is valid.
+func checkGlob(pattern string) error {
+	for _, p := range strings.Split(pattern, string(filepath.Separator)) {
+		if p == "**" {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Report if path matches pattern, where "**" matches any number of path
+// elements.
+func matchGlob(pattern, path string) bool {
+	return matchParts(
+		strings.Split(pattern, string(filepath.Separator)),
+		strings.Split(path, string(filepath.Separator)))
+}
+
+func matchParts(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchParts(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
@@ -0,0 +1,104 @@
+package reload
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"tpl/*.tmpl", "tpl/a.tmpl", true},
+		{"tpl/*.tmpl", "tpl/a.go", false},
+		{"tpl/*.tmpl", "tpl/x/a.tmpl", false},
+		{"tpl/**/*.tmpl", "tpl/a.tmpl", true},
+		{"tpl/**/*.tmpl", "tpl/x/y/a.tmpl", true},
+		{"tpl/**/*.tmpl", "tpl/x/y/a.go", false},
+		{"tpl/**", "tpl/x/y", true},
+		{"*/a.tmpl", "tpl/a.tmpl", true},
+		{"*/a.tmpl", "tpl/x/a.tmpl", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			got := matchGlob(filepath.FromSlash(tt.pattern), filepath.FromSlash(tt.path))
+			if got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobBase(t *testing.T) {
+	tests := []struct {
+		pattern, base string
+		recursive     bool
+	}{
+		{"tpl/*.tmpl", "tpl", false},
+		{"tpl/**/*.tmpl", "tpl", true},
+		{"a/b/*/c.tmpl", "a/b", true},
+		{"*.tmpl", ".", false},
+		{"tpl/a.tmpl", "tpl", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			d := Glob(filepath.FromSlash(tt.pattern), nil)
+			if d.path != filepath.FromSlash(tt.base) || d.recursive != tt.recursive {
+				t.Errorf("got %q, %t; want %q, %t", d.path, d.recursive, tt.base, tt.recursive)
+			}
+		})
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Mkdir(filepath.Join(tmp, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Do(log.Printf, WithWatcher(newFakeWatcher()), Glob(filepath.Join(tmp, "[*.tmpl"), func() {}))
+	if !errorContains(err, "invalid pattern") {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	var (
+		w      = newFakeWatcher()
+		called = make(chan struct{}, 2)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Glob(filepath.Join(tmp, "**", "*.tmpl"), func() { called <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "sub", "a.go"), Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "sub", "a.tmpl"), Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	select {
+	case <-called:
+		t.Error("callback run for file that doesn't match")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if !contains(w.Added(), filepath.Join(tmp, "sub")) {
+		t.Errorf("sub not watched: %q", w.Added())
+	}
+}
@@ -0,0 +1,47 @@
+package reload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RunningFromTemp reports if the binary looks like it was built by "go run".
+//
+// That binary is a temporary file that's never rebuilt in place, so changing
+// the source doesn't restart the process; use "go build" or BuildAndReload()
+// instead. To only run the Dir() callbacks in this case use:
+//
+//    reload.Do(log.Printf, reload.Config{IgnoreBinary: reload.RunningFromTemp()})
+func RunningFromTemp() bool {
+	bin, err := self()
+	if err != nil {
+		return false
+	}
+	return isTempBinary(bin, goCache())
+}
+
+// Get the Go build cache directory, without running "go env".
+func goCache() string {
+	if c := os.Getenv("GOCACHE"); c != "" {
+		return c
+	}
+	c, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(c, "go-build")
+}
+
+// "go run" builds to $WORK/b001/exe/name, where $WORK is a go-build* directory
+// in the temporary directory. Newer versions may use the build cache instead.
+func isTempBinary(bin, cache string) bool {
+	if cache != "" && strings.HasPrefix(bin, cache+string(filepath.Separator)) {
+		return true
+	}
+	dir := filepath.Dir(bin)
+	if filepath.Base(dir) != "exe" {
+		return false
+	}
+	return strings.HasPrefix(filepath.Base(filepath.Dir(filepath.Dir(dir))), "go-build")
+}
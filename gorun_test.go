@@ -0,0 +1,30 @@
+package reload
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIsTempBinary(t *testing.T) {
+	cache := filepath.FromSlash("/home/x/.cache/go-build")
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"/tmp/go-build123/b001/exe/app", true},
+		{"/var/folders/xy/T/go-build123/b001/exe/app", true},
+		{"/home/x/.cache/go-build/ab/abcdef-d/app", true},
+		{"/tmp/go-build123/b001/reload.test", false},
+		{"/home/x/go/bin/app", false},
+		{"/home/x/src/exe/app", false},
+		{"/home/x/.cache/go-build-other/app", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := isTempBinary(filepath.FromSlash(tt.in), cache); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
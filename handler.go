@@ -0,0 +1,139 @@
+package reload
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Handler returns a HTTP handler to restart the process and show the current
+// status, e.g. for a /debug/reload endpoint in a development server:
+//
+//    http.Handle("/debug/reload", reload.Handler())
+//
+// A POST request triggers a restart with Restart(), so it goes through the
+// same steps as a binary change; it responds with 202 Accepted, or 503 Service
+// Unavailable if Do() isn't running. Add ?force=1 to use ForceRestart()
+// instead, to restart outside the WithRestartWindow() window.
+//
+// A GET request shows what's being watched, the counters from Stats(), and the
+// restart from Pending() if there is one; it doesn't change anything. Other
+// methods are rejected with 405 Method Not Allowed.
+//
+// Paths ending in /status and /trigger only accept GET and POST respectively,
+// so it can also be mounted on a prefix:
+//
+//    mux.Handle("/reload/", reload.Handler()) // GET /reload/status, POST /reload/trigger
+//
+// The handler isn't registered anywhere by default. There is no
+// authentication; use a middleware if the server is reachable by others.
+func Handler() http.Handler {
+	return http.HandlerFunc(serveHTTP)
+}
+
+// Response for a POST request.
+type handlerRestart struct {
+	Generation int       `json:"generation"`
+	Time       time.Time `json:"time"`
+}
+
+// Response for a GET request.
+type handlerStatus struct {
+	Running    bool       `json:"running"`
+	Pending    bool       `json:"pending"` // A restart is waiting to be handled, or postponed.
+	Binary     string     `json:"binary,omitempty"`
+	Dirs       []string   `json:"dirs"`
+	Callbacks  []string   `json:"callbacks"`
+	Generation int        `json:"generation"`
+	LastReload *time.Time `json:"last_reload,omitempty"`
+
+	Restarts      int            `json:"restarts"`
+	DirCallbacks  map[string]int `json:"dir_callbacks"`
+	WatcherErrors int            `json:"watcher_errors"`
+	EventsSeen    int            `json:"events_seen"`
+
+	PendingRestart *handlerPending `json:"pending_restart,omitempty"` // From Pending().
+}
+
+type handlerPending struct {
+	Reason   string    `json:"reason"`
+	Path     string    `json:"path,omitempty"`
+	Detected time.Time `json:"detected"`
+	Policy   string    `json:"policy"`
+	Checksum string    `json:"checksum,omitempty"`
+}
+
+func serveHTTP(w http.ResponseWriter, r *http.Request) {
+	allow := "GET, HEAD, POST"
+	switch path.Base(r.URL.Path) {
+	case "status":
+		allow = "GET, HEAD"
+	case "trigger":
+		allow = "POST"
+	}
+	if !contains(strings.Split(allow, ", "), r.Method) {
+		w.Header().Set("Allow", allow)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		if !running() {
+			http.Error(w, "reload.Do() isn't running", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Query().Get("force") == "1" {
+			ForceRestart()
+		} else {
+			Restart()
+		}
+		writeJSON(w, http.StatusAccepted, handlerRestart{Generation: Generation(), Time: time.Now()})
+	case http.MethodGet, http.MethodHead:
+		var (
+			watched = Watched()
+			stats   = Stats()
+		)
+		s := handlerStatus{
+			Running:       running(),
+			Pending:       len(manual) > 0 || stats.RestartPending,
+			Binary:        watched.Binary,
+			Dirs:          watched.Dirs,
+			Callbacks:     watched.Callbacks,
+			Generation:    Generation(),
+			Restarts:      stats.Restarts,
+			DirCallbacks:  stats.DirCallbacks,
+			WatcherErrors: stats.WatcherErrors,
+			EventsSeen:    stats.EventsSeen,
+		}
+		if t, ok := LastReload(); ok {
+			s.LastReload = &t
+		}
+		if ok, p := Pending(); ok {
+			s.Pending = true
+			s.PendingRestart = &handlerPending{
+				Reason:   p.Reason.String(),
+				Path:     p.Reason.Path,
+				Detected: p.Detected,
+				Policy:   p.Policy.String(),
+				Checksum: p.Checksum,
+			}
+		}
+		writeJSON(w, http.StatusOK, s)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Report if Do() is running.
+func running() bool {
+	runMu.Lock()
+	defer runMu.Unlock()
+	return stopC != nil
+}
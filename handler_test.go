@@ -0,0 +1,139 @@
+package reload
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	doPath := func(method, path string, want int, v interface{}) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		Handler().ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		if rr.Code != want {
+			t.Fatalf("%s %s: status %d; want %d: %s", method, path, rr.Code, want, rr.Body)
+		}
+		if v != nil {
+			if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+				t.Fatalf("%s %s: %s: %s", method, path, err, rr.Body)
+			}
+		}
+	}
+	do := func(method string, want int, v interface{}) {
+		t.Helper()
+		doPath(method, "/debug/reload", want, v)
+	}
+
+	var s handlerStatus
+	do(http.MethodPost, http.StatusServiceUnavailable, nil)
+	do(http.MethodGet, http.StatusOK, &s)
+	if s.Running {
+		t.Error("running before Do()")
+	}
+
+	var (
+		w         = newFakeWatcher()
+		started   = make(chan struct{})
+		restarted = make(chan Reason, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Config{OnStart: func([]string) { close(started) }},
+			Dir(tmp, func() {}),
+			WithRestart(func(r Reason) { restarted <- r }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	<-started
+
+	s = handlerStatus{}
+	do(http.MethodGet, http.StatusOK, &s)
+	if !s.Running || s.Pending || s.Binary == "" || !contains(s.Dirs, tmp) || !contains(s.Callbacks, tmp) {
+		t.Errorf("wrong status: %#v", s)
+	}
+	select {
+	case <-restarted:
+		t.Fatal("GET restarted")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var p handlerRestart
+	do(http.MethodPost, http.StatusAccepted, &p)
+	if p.Generation != Generation() || p.Time.IsZero() {
+		t.Errorf("wrong response: %#v", p)
+	}
+	select {
+	case r := <-restarted:
+		if r.Kind != Manual {
+			t.Errorf("wrong reason: %s", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+
+	do(http.MethodDelete, http.StatusMethodNotAllowed, nil)
+
+	// Mounted on a prefix.
+	doPath(http.MethodPost, "/reload/status", http.StatusMethodNotAllowed, nil)
+	doPath(http.MethodGet, "/reload/trigger", http.StatusMethodNotAllowed, nil)
+	s = handlerStatus{}
+	doPath(http.MethodGet, "/reload/status", http.StatusOK, &s)
+	if !s.Running || s.Restarts < 1 || s.DirCallbacks == nil {
+		t.Errorf("wrong status: %#v", s)
+	}
+	doPath(http.MethodPost, "/reload/trigger", http.StatusAccepted, &p)
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+}
+
+func TestHandlerPending(t *testing.T) {
+	var (
+		w = newFakeWatcher()
+		l = &testLogger{}
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithApproval(), WithRestart(func(Reason) {}))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: new binary detected, awaiting approval")
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/reload", nil))
+	var s handlerStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	p := s.PendingRestart
+	if !s.Pending || p == nil {
+		t.Fatalf("not pending: %s", rr.Body)
+	}
+	if p.Policy != "approval" || p.Path != launch || p.Checksum == "" || p.Detected.IsZero() ||
+		!strings.HasPrefix(p.Reason, "binary changed") {
+		t.Errorf("wrong pending_restart: %s", rr.Body)
+	}
+}
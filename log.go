@@ -0,0 +1,89 @@
+package reload
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Logger is a leveled logger; use WithLogger() to set it.
+type Logger interface {
+	// Infof logs informational messages, such as the startup message and
+	// restarts.
+	Infof(format string, args ...interface{})
+	// Errorf logs errors that occur after Do() is initialized.
+	Errorf(format string, args ...interface{})
+	// Debugf logs messages that are only useful to find out why something
+	// did or didn't happen.
+	Debugf(format string, args ...interface{})
+}
+
+// LogFunc adapts a printf-style log function, such as log.Printf, to a Logger.
+// Debug messages are discarded.
+type LogFunc func(string, ...interface{})
+
+// Infof implements Logger.
+func (f LogFunc) Infof(format string, args ...interface{}) { f(format, args...) }
+
+// Errorf implements Logger.
+func (f LogFunc) Errorf(format string, args ...interface{}) { f(format, args...) }
+
+// Debugf implements Logger.
+func (f LogFunc) Debugf(string, ...interface{}) {}
+
+// WithDebug logs every event from the watcher, and what was done with it. This
+// is useful to find out why something did or didn't get reloaded.
+//
+// The messages are logged with the Logger's Debugf(); for a log function they
+// are logged as any other message.
+func WithDebug() Option {
+	return optionFunc(func(r *reloader) { r.debug = true })
+}
+
+// LogFunc that doesn't discard debug messages, for WithDebug().
+type debugLogFunc struct{ LogFunc }
+
+func (f debugLogFunc) Debugf(format string, args ...interface{}) { f.LogFunc(format, args...) }
+
+// WithLogger logs to a leveled Logger instead of the log function passed to
+// Do(), which may be nil if this is used.
+func WithLogger(l Logger) Option {
+	return optionFunc(func(r *reloader) { r.logger = l })
+}
+
+// StdLog returns a log function for Do() that logs with log.Printf, prefixed
+// with "[prefix]". The prefix is colored if the standard logger writes to a
+// terminal and $NO_COLOR isn't set.
+//
+//    reload.Do(reload.StdLog("reload"))
+func StdLog(prefix string) func(string, ...interface{}) {
+	prefix = "[" + prefix + "] "
+	if isTerminal(log.Writer()) && os.Getenv("NO_COLOR") == "" {
+		prefix = "\x1b[36m" + prefix[:len(prefix)-1] + "\x1b[0m "
+	}
+	return func(format string, args ...interface{}) {
+		// Most messages already start with "reload: ".
+		log.Print(prefix + fmt.Sprintf(strings.TrimPrefix(format, "reload: "), args...))
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	s, err := f.Stat()
+	return err == nil && s.Mode()&os.ModeCharDevice != 0
+}
+
+// Logger for restart strategies, set by Do().
+var logger Logger = LogFunc(log.Printf)
+
+// Logger that can emit structured records, such as log/slog.
+type structuredLogger interface {
+	Logger
+	info(msg string, kv ...interface{})
+	error(msg string, kv ...interface{})
+}
@@ -0,0 +1,121 @@
+package reload
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (l *testLogger) add(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = append(l.log, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Infof(f string, a ...interface{})  { l.add("INFO", f, a...) }
+func (l *testLogger) Errorf(f string, a ...interface{}) { l.add("ERROR", f, a...) }
+func (l *testLogger) Debugf(f string, a ...interface{}) { l.add("DEBUG", f, a...) }
+
+func (l *testLogger) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string{}, l.log...)
+}
+
+// Wait until a line with the prefix is logged.
+func (l *testLogger) wait(t *testing.T, prefix string) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(5 * time.Millisecond) {
+		for _, line := range l.lines() {
+			if strings.HasPrefix(line, prefix) {
+				return
+			}
+		}
+	}
+	t.Fatalf("%q not logged; have:\n%s", prefix, strings.Join(l.lines(), "\n"))
+}
+
+func TestWithLogger(t *testing.T) {
+	var (
+		l = &testLogger{}
+		w = newFakeWatcher()
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	w.errors <- fmt.Errorf("oops")
+	l.wait(t, "ERROR reload error: oops")
+}
+
+func TestWithDebug(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, opt := range []Option{WithDebug(), Config{Verbose: true}} {
+		t.Run(fmt.Sprintf("%T", opt), func(t *testing.T) {
+			var (
+				l    = &testLogger{}
+				w    = newFakeWatcher()
+				file = filepath.Join(tmp, "file")
+			)
+			go func() {
+				err := Do(LogFunc(l.Infof), opt, WithWatcher(w), Dir(tmp, func() {}))
+				if err != nil {
+					panic(err)
+				}
+			}()
+			defer Stop()
+			l.wait(t, "INFO restarting")
+
+			w.events <- WatchEvent{Name: file, Op: OpChmod}
+			l.wait(t, fmt.Sprintf("INFO reload: event CHMOD %q", file))
+			l.wait(t, fmt.Sprintf("INFO reload: ignored %q: wrong op CHMOD", file))
+
+			w.events <- WatchEvent{Name: "/other", Op: OpCreate | OpWrite}
+			l.wait(t, `INFO reload: ignored "/other": not a watched prefix`)
+
+			w.events <- WatchEvent{Name: file, Op: OpCreate | OpWrite}
+			l.wait(t, fmt.Sprintf("INFO reload: triggered %q: dir %q", file, tmp))
+		})
+	}
+}
+
+func TestStdLog(t *testing.T) {
+	var buf strings.Builder
+	defer func(w io.Writer, f int) { log.SetOutput(w); log.SetFlags(f) }(log.Writer(), log.Flags())
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+
+	l := StdLog("app")
+	l("reload: error %d", 1)
+	l("restarting %q", "x")
+	if got, want := buf.String(), "[app] error 1\n[app] restarting \"x\"\n"; got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	buf.Reset()
+	StdLog("100%")("restarting %q", "x")
+	if got, want := buf.String(), "[100%] restarting \"x\"\n"; got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
@@ -0,0 +1,207 @@
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Manager watches several binaries and restarts each one separately when it
+// changes, for example to run all services of a monorepo as child processes in
+// one development session.
+//
+// This is independent from Do(), which restarts the current process.
+//
+//    m := reload.NewManager()
+//    m.Add("bin/api", restartAPI)
+//    m.Add("bin/worker", restartWorker)
+//    err := m.Run(log.Printf)
+type Manager struct {
+	mu      sync.Mutex
+	bins    []managed
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type managed struct {
+	path    string // As given to Add(), for logging.
+	watch   []string
+	restart func()
+}
+
+// NewManager creates a new Manager; use Add() to add binaries and Run() to
+// start watching them.
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Add a binary to watch; restart is called when it changes. If the binary is
+// a symlink both the link and its target are watched.
+//
+// This must be called before Run().
+func (m *Manager) Add(path string, restart func()) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("reload.Manager: cannot get absolute path to %q: %w", path, err)
+	}
+	watch := []string{abs}
+	if real, err := filepath.EvalSymlinks(abs); err == nil && real != abs {
+		watch = append(watch, real)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return errors.New("reload.Manager: can't add binaries while running")
+	}
+	m.bins = append(m.bins, managed{path: path, watch: watch, restart: restart})
+	return nil
+}
+
+// Run watches all binaries until Stop() is called.
+//
+// The restart functions are called from a single goroutine, so they should
+// return quickly. Only WithLogger(), WithWatcher(), WithDebug(),
+// Config.TriggerOp, and Config.Verbose are used from the options.
+func (m *Manager) Run(log func(string, ...interface{}), opts ...Option) error {
+	var r reloader
+	for _, o := range opts {
+		o.apply(&r)
+	}
+	l := r.logger
+	if l == nil {
+		l = LogFunc(log)
+	}
+	debug := r.debug || r.cfg.Verbose
+	if f, ok := l.(LogFunc); ok && debug {
+		l = debugLogFunc{f}
+	}
+
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return errors.New("reload.Manager: already running")
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	m.stop, m.stopped = stop, stopped
+	bins := m.bins
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		select {
+		case <-stop:
+		default:
+			close(stop)
+		}
+		m.stop, m.stopped = nil, nil
+		m.mu.Unlock()
+		close(stopped)
+	}()
+
+	watcher := r.watcher
+	if watcher == nil {
+		var err error
+		if watcher, err = newFSWatcher(); err != nil {
+			return fmt.Errorf("reload.Manager: cannot setup watcher: %w", err)
+		}
+	}
+	defer watcher.Close()
+
+	// Watch the directories rather than the binaries; see Do().
+	seen := make(map[string]bool)
+	for _, b := range bins {
+		for _, p := range b.watch {
+			d := filepath.Dir(p)
+			if seen[d] {
+				continue
+			}
+			seen[d] = true
+			if err := addWatch(watcher, d); err != nil {
+				return fmt.Errorf("reload.Manager: %w", err)
+			}
+		}
+	}
+
+	triggerOp := r.cfg.TriggerOp
+	if triggerOp == 0 {
+		triggerOp = defaultTriggerOp(l)
+	}
+
+	// Wait for writes to finish for every binary separately.
+	var (
+		settle = make(map[int]*time.Timer)
+		fire   = make(chan int)
+	)
+	defer func() {
+		for _, t := range settle {
+			t.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case i := <-fire:
+			delete(settle, i)
+			l.Infof("reload: restarting %q", relpath(bins[i].path))
+			bins[i].restart()
+		case err, ok := <-watcher.Errors():
+			if !ok {
+				return &WatchError{Err: errors.New("reload.Manager: error channel closed")}
+			}
+			if isFatal(err) {
+				return &WatchError{Err: fmt.Errorf("reload.Manager: %w", err)}
+			}
+			l.Errorf("reload: %v", err)
+		case event, ok := <-watcher.Events():
+			if !ok {
+				return &WatchError{Err: errors.New("reload.Manager: event channel closed")}
+			}
+			if debug {
+				l.Debugf("reload: event %s %q", event.Op, event.Name)
+			}
+			if event.Op&triggerOp == 0 {
+				continue
+			}
+			for i, b := range bins {
+				if !contains(b.watch, event.Name) {
+					continue
+				}
+				if t, ok := settle[i]; ok {
+					if t.Stop() {
+						t.Reset(100 * time.Millisecond)
+					} // Else it already fired and will restart anyway.
+					continue
+				}
+				i := i
+				settle[i] = time.AfterFunc(100*time.Millisecond, func() {
+					select {
+					case fire <- i:
+					case <-stop:
+					}
+				})
+			}
+		}
+	}
+}
+
+// Stop stops Run(), and waits for it to return. It does nothing if Run()
+// isn't running.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	if m.stop == nil {
+		m.mu.Unlock()
+		return
+	}
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	stopped := m.stopped
+	m.mu.Unlock()
+	<-stopped
+}
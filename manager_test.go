@@ -0,0 +1,91 @@
+package reload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		m         = NewManager()
+		w         = newFakeWatcher()
+		api       = filepath.Join(tmp, "api", "api")
+		worker    = filepath.Join(tmp, "worker", "worker")
+		restarted = make(chan string, 4)
+		ret       = make(chan error, 1)
+	)
+	for _, b := range []string{api, worker} {
+		b := b
+		if err := m.Add(b, func() { restarted <- b }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go func() { ret <- m.Run(log.Printf, WithWatcher(w), Config{TriggerOp: OpWrite}) }()
+
+	// Multiple events for one binary restart it once.
+	w.events <- WatchEvent{Name: worker, Op: OpWrite}
+	w.events <- WatchEvent{Name: worker, Op: OpWrite}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "api", "other"), Op: OpWrite}
+	select {
+	case got := <-restarted:
+		if got != worker {
+			t.Errorf("restarted %q; want %q", got, worker)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+	select {
+	case got := <-restarted:
+		t.Errorf("also restarted %q", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := m.Add(api, func() {}); err == nil {
+		t.Error("no error adding binary while running")
+	}
+	for _, d := range []string{filepath.Dir(api), filepath.Dir(worker)} {
+		if !contains(w.Added(), d) {
+			t.Errorf("%q not watched: %q", d, w.Added())
+		}
+	}
+
+	m.Stop()
+	if err := <-ret; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerDebug(t *testing.T) {
+	var (
+		m   = NewManager()
+		w   = newFakeWatcher()
+		l   = &testLogger{}
+		ret = make(chan error, 1)
+		bin = filepath.Join(os.TempDir(), "app")
+	)
+	if err := m.Add(bin, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	go func() { ret <- m.Run(nil, WithLogger(l), WithWatcher(w), Config{Verbose: true}) }()
+
+	w.events <- WatchEvent{Name: bin, Op: OpChmod}
+	l.wait(t, fmt.Sprintf("DEBUG reload: event CHMOD %q", bin))
+	m.Stop()
+	if err := <-ret; err != nil {
+		t.Fatal(err)
+	}
+}
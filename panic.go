@@ -0,0 +1,39 @@
+package reload
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is reported when a Dir() callback or the restart function
+// panics; the panic is recovered and the event loop keeps running, unless
+// Config.Repanic is set.
+type PanicError struct {
+	Path  string      // Path passed to Dir(); empty for the restart function.
+	Value interface{} // Value passed to panic().
+	Stack []byte      // Stack trace of the goroutine that panicked.
+}
+
+func (e *PanicError) Error() string {
+	what := "restart function"
+	if e.Path != "" {
+		what = fmt.Sprintf("callback for %q", relpath(e.Path))
+	}
+	return fmt.Sprintf("panic in %s: %v\n%s", what, e.Value, e.Stack)
+}
+
+// Run fn, and report a panic as a *PanicError instead of crashing the process.
+// It panics again after reporting if repanic is set.
+func recoverPanic(l Logger, path string, repanic bool, fn func()) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		logError(l, &PanicError{Path: path, Value: v, Stack: debug.Stack()})
+		if repanic {
+			panic(v)
+		}
+	}()
+	fn()
+}
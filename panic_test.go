@@ -0,0 +1,92 @@
+package reload
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		called    = make(chan struct{}, 2)
+		restarted = make(chan struct{}, 2)
+		calls     int
+		restarts  int
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w),
+			Dir(tmp, func() {
+				calls++
+				called <- struct{}{}
+				if calls == 1 {
+					var m map[string]int
+					m["x"] = 1
+				}
+			}),
+			WithRestart(func(Reason) {
+				restarts++
+				restarted <- struct{}{}
+				if restarts == 1 {
+					panic("oops")
+				}
+			}))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	wait := func(c chan struct{}) {
+		t.Helper()
+		select {
+		case <-c:
+		case <-time.After(time.Second):
+			t.Fatal("not called")
+		}
+	}
+
+	// Events are still handled after a callback panicked.
+	for i := 0; i < 2; i++ {
+		w.events <- WatchEvent{Name: filepath.Join(tmp, "x"), Op: OpCreate | OpWrite}
+		wait(called)
+	}
+	l.wait(t, `ERROR reload error: panic in callback for "`+relpath(tmp)+`": assignment to entry in nil map`)
+
+	_, launch := binPaths()
+	for i := 0; i < 2; i++ {
+		w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+		wait(restarted)
+	}
+	l.wait(t, "ERROR reload error: panic in restart function: oops")
+
+	for _, line := range l.lines() {
+		if strings.HasPrefix(line, "ERROR reload error: panic in restart function") &&
+			!strings.Contains(line, "panic_test.go") {
+			t.Errorf("no stack trace:\n%s", line)
+		}
+	}
+}
+
+func TestRepanic(t *testing.T) {
+	l := &testLogger{}
+	defer func() {
+		if v := recover(); v != "oops" {
+			t.Errorf("wrong panic: %v", v)
+		}
+		l.wait(t, "ERROR reload error: panic in callback for \"dir\": oops")
+	}()
+	recoverPanic(l, "dir", true, func() { panic("oops") })
+	t.Error("didn't panic again")
+}
@@ -0,0 +1,69 @@
+package reload
+
+import (
+	"sync"
+	"time"
+)
+
+// HoldPolicy is what's holding back a pending restart.
+type HoldPolicy int
+
+// Hold policies.
+const (
+	HeldByWindow     HoldPolicy = iota + 1 // Outside the WithRestartWindow() window.
+	HeldByCanRestart                       // Config.CanRestart returned false.
+	HeldByBusy                             // The WithBusyCheck() check returned true.
+	HeldByApproval                         // Waiting for Approve(), with WithApproval().
+	HeldByDisabled                         // Disable() was called.
+)
+
+func (p HoldPolicy) String() string {
+	switch p {
+	case HeldByWindow:
+		return "window"
+	case HeldByCanRestart:
+		return "can_restart"
+	case HeldByBusy:
+		return "busy"
+	case HeldByApproval:
+		return "approval"
+	case HeldByDisabled:
+		return "disabled"
+	default:
+		return "unknown"
+	}
+}
+
+// PendingInfo describes a restart that's been detected but is held back.
+type PendingInfo struct {
+	Reason   Reason     // What triggered the restart; the latest one if there were several.
+	Detected time.Time  // When the restart was first held back.
+	Policy   HoldPolicy // What's holding it back.
+	Checksum string     // Hex-encoded SHA-256 of Reason.Path, with HeldByApproval.
+}
+
+var (
+	pendingMu sync.Mutex
+	pending   *PendingInfo
+)
+
+// Pending reports if a restart is held back by WithRestartWindow(),
+// Config.CanRestart, WithBusyCheck(), WithApproval(), or Disable(), and why.
+//
+// This is updated before the decision to hold back or go ahead with a restart
+// is logged or acted on, so it's never out of date by more than the restart
+// itself.
+func Pending() (bool, PendingInfo) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	if pending == nil {
+		return false, PendingInfo{}
+	}
+	return true, *pending
+}
+
+func setPending(p *PendingInfo) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	pending = p
+}
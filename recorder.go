@@ -0,0 +1,34 @@
+package reload
+
+import "time"
+
+// Recorder is called for things that happen in Do(), for example to update
+// metrics. The methods are called from the goroutine that watches for changes,
+// so they should return quickly.
+type Recorder interface {
+	// RestartTriggered is called right before a restart. The file is the
+	// path that changed, or empty if the restart wasn't caused by a file
+	// change.
+	RestartTriggered(file string)
+
+	// CallbackRan is called after a Dir() callback returned. For DirFiles()
+	// the file is the first of the changed files.
+	CallbackRan(dir, file string, dur time.Duration)
+
+	// Error is called for every error that's sent to Errors().
+	Error(err error)
+}
+
+// WithRecorder calls the Recorder for restarts, callbacks, and errors.
+func WithRecorder(rec Recorder) Option {
+	return optionFunc(func(r *reloader) { r.recorder = rec })
+}
+
+// Recorder for restart strategies and errors, set by Do().
+var recorder Recorder = nopRecorder{}
+
+type nopRecorder struct{}
+
+func (nopRecorder) RestartTriggered(string)                   {}
+func (nopRecorder) CallbackRan(string, string, time.Duration) {}
+func (nopRecorder) Error(error)                               {}
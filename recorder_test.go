@@ -0,0 +1,80 @@
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *testRecorder) add(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, s)
+}
+
+func (r *testRecorder) RestartTriggered(file string) { r.add("restart " + file) }
+func (r *testRecorder) CallbackRan(dir, file string, _ time.Duration) {
+	r.add(fmt.Sprintf("callback %s %s", dir, file))
+}
+func (r *testRecorder) Error(err error) { r.add("error " + err.Error()) }
+
+func TestRecorder(t *testing.T) {
+	defer func() { recorder = nopRecorder{} }()
+
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		rec       = &testRecorder{}
+		w         = newFakeWatcher()
+		restarted = make(chan struct{}, 1)
+		called    = make(chan struct{}, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), WithRecorder(rec),
+			Dir(tmp, func() { called <- struct{}{} }),
+			WithRestart(func(Reason) { restarted <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	file := filepath.Join(tmp, "file")
+	w.events <- WatchEvent{Name: file, Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	w.errors <- errors.New("oops")
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	select {
+	case <-restarted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not restarted")
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	want := []string{"callback " + tmp + " " + file, "error oops", "restart " + launch}
+	if !reflect.DeepEqual(rec.calls, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", rec.calls, want)
+	}
+}
@@ -0,0 +1,56 @@
+package reload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directories skipped when watching recursively, unless Config.SkipDirs is
+// set.
+var defaultSkipDirs = []string{".git", ".hg", ".svn", "node_modules", "vendor"}
+
+// DirRecursive is like Dir, but also watches all subdirectories, including
+// ones created later.
+//
+// Directories in Config.SkipDirs (.git, node_modules, vendor, etc. by default)
+// are skipped, as is anything deeper than Config.MaxDepth.
+func DirRecursive(path string, cb func()) dir {
+	return dir{path: path, cb: cb, recursive: true}
+}
+
+// Get all directories in root that should be watched; depth is the depth of
+// root itself relative to the watched directory.
+func walkDirs(root string, depth, maxDepth int, skip []string) ([]string, error) {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Directory may have been removed while we're walking it.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != root && contains(skip, info.Name()) {
+			return filepath.SkipDir
+		}
+		if maxDepth > 0 && depth+pathDepth(root, path) > maxDepth {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs, err
+}
+
+// Get the number of directories between root and path.
+func pathDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
@@ -0,0 +1,56 @@
+package reload
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkDirs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, d := range []string{"a/b/c", "a/node_modules/x", "vendor/y", ".git/objects", "d"} {
+		if err := os.MkdirAll(filepath.Join(tmp, filepath.FromSlash(d)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "a", "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		maxDepth int
+		skip     []string
+		want     []string
+	}{
+		{0, defaultSkipDirs, []string{"", "a", "a/b", "a/b/c", "d"}},
+		{1, defaultSkipDirs, []string{"", "a", "d"}},
+		{2, defaultSkipDirs, []string{"", "a", "a/b", "d"}},
+		{1, []string{}, []string{"", ".git", "a", "d", "vendor"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			out, err := walkDirs(tmp, 0, tt.maxDepth, tt.skip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range out {
+				out[i], _ = filepath.Rel(tmp, out[i])
+				out[i] = filepath.ToSlash(out[i])
+				if out[i] == "." {
+					out[i] = ""
+				}
+			}
+			if !reflect.DeepEqual(out, tt.want) {
+				t.Errorf("\nout:  %v\nwant: %v", out, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package reload
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NoRefreshHeader is a request header to stop RefreshMiddleware() from adding
+// the script to the response, e.g. for HTMX partials.
+const NoRefreshHeader = "X-Reload-No-Refresh"
+
+// sseEndpoint is where LiveReloadJS connects to.
+const sseEndpoint = "/debug/reload/events"
+
+// RefreshMiddleware reloads HTML pages in the browser when something changed,
+// by adding LiveReloadJS before </body>. The SSEHandler() for it is served on
+// /debug/reload/events, so nothing else needs to be set up:
+//
+//    http.ListenAndServe(":8080", reload.RefreshMiddleware(mux))
+//
+// Only responses that are text/html are changed, either from the Content-Type
+// header or detected from the content if it's not set. Compressed responses
+// (with a Content-Encoding) and requests with the NoRefreshHeader header are
+// left alone. HTML responses are buffered, and the Content-Length is set to
+// the new length.
+func RefreshMiddleware(next http.Handler) http.Handler {
+	sse := SSEHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == sseEndpoint {
+			sse.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodHead || r.Header.Get(NoRefreshHeader) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rw := &refreshWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		rw.finish()
+	})
+}
+
+type refreshWriter struct {
+	http.ResponseWriter
+	code    int
+	decided bool // Know if we inject the script or not.
+	inject  bool
+	buf     bytes.Buffer
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *refreshWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *refreshWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *refreshWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		// Buffer enough to detect the content type, like net/http.
+		if w.Header().Get("Content-Type") == "" {
+			w.buf.Write(p)
+			if w.buf.Len() < 512 {
+				return len(p), nil
+			}
+			w.decideBuffered()
+			return len(p), nil
+		}
+		w.decide(p)
+	}
+	if w.inject {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *refreshWriter) Flush() {
+	if !w.decided {
+		w.decideBuffered()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.inject {
+		f.Flush()
+	}
+}
+
+// Decide if this is a response we can add the script to, from the headers and
+// the start of the body.
+func (w *refreshWriter) decide(p []byte) {
+	w.decided = true
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+
+	h := w.Header()
+	ct := h.Get("Content-Type")
+	if ct == "" && p != nil {
+		ct = http.DetectContentType(p)
+	}
+	w.inject = strings.HasPrefix(ct, "text/html") &&
+		h.Get("Content-Encoding") == "" &&
+		w.code != http.StatusNoContent && w.code != http.StatusNotModified
+	if w.inject {
+		h.Set("Content-Type", ct)
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+// Decide from what was buffered so far, and write it if we don't inject.
+func (w *refreshWriter) decideBuffered() {
+	if w.buf.Len() == 0 {
+		w.decide(nil)
+		return
+	}
+	w.decide(w.buf.Bytes())
+	if !w.inject {
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *refreshWriter) finish() {
+	if !w.decided {
+		w.decideBuffered()
+	}
+	if !w.inject {
+		return
+	}
+
+	body := w.buf.Bytes()
+	i := lastBodyTag(body)
+	if i == -1 {
+		i = len(body)
+	}
+	out := make([]byte, 0, len(body)+len(LiveReloadJS))
+	out = append(out, body[:i]...)
+	out = append(out, LiveReloadJS...)
+	out = append(out, body[i:]...)
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.ResponseWriter.WriteHeader(w.code)
+	_, _ = w.ResponseWriter.Write(out)
+}
+
+// Find the last "</body>", in any case. This doesn't use bytes.ToLower(), as
+// that may change the length of non-ASCII text.
+func lastBodyTag(body []byte) int {
+	tag := []byte("</body>")
+	for i := bytes.LastIndex(body, []byte("</")); i != -1; i = bytes.LastIndex(body[:i], []byte("</")) {
+		if i+len(tag) <= len(body) && bytes.EqualFold(body[i:i+len(tag)], tag) {
+			return i
+		}
+	}
+	return -1
+}
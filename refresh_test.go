@@ -0,0 +1,93 @@
+package reload
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRefreshMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  map[string]string // Response headers.
+		reqHdr  string
+		method  string
+		code    int
+		body    string
+		want    string
+		wantLen bool // Content-Length should be set.
+	}{
+		{"html", map[string]string{"Content-Type": "text/html; charset=utf-8", "Content-Length": "26"}, "", "GET", 200,
+			"<html><body>x</body></html>", "<html><body>x" + LiveReloadJS + "</body></html>", true},
+		{"sniffed", nil, "", "GET", 200,
+			"<!DOCTYPE html><BODY>x</BODY>", "<!DOCTYPE html><BODY>x" + LiveReloadJS + "</BODY>", true},
+		{"multibyte", map[string]string{"Content-Type": "text/html"}, "", "GET", 200,
+			"<body>İİİx</Body>", "<body>İİİx" + LiveReloadJS + "</Body>", true},
+		{"no body tag", map[string]string{"Content-Type": "text/html"}, "", "GET", 404,
+			"<p>not found", "<p>not found" + LiveReloadJS, true},
+		{"json", map[string]string{"Content-Type": "application/json"}, "", "GET", 200,
+			`{"a":"</body>"}`, `{"a":"</body>"}`, false},
+		{"sniffed text", nil, "", "GET", 200,
+			"hello </body>", "hello </body>", false},
+		{"sniffed large", nil, "", "GET", 200,
+			strings.Repeat("a", 2000), strings.Repeat("a", 2000), false},
+		{"compressed", map[string]string{"Content-Type": "text/html", "Content-Encoding": "gzip"}, "", "GET", 200,
+			"</body>", "</body>", false},
+		{"opt out", map[string]string{"Content-Type": "text/html"}, NoRefreshHeader, "GET", 200,
+			"<body></body>", "<body></body>", false},
+		{"head", map[string]string{"Content-Type": "text/html"}, "", "HEAD", 200,
+			"", "", false},
+		{"no content", map[string]string{"Content-Type": "text/html"}, "", "GET", 204,
+			"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RefreshMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.code)
+				// Write in two parts, to make sure it's all buffered.
+				w.Write([]byte(tt.body[:len(tt.body)/2]))
+				w.Write([]byte(tt.body[len(tt.body)/2:]))
+			}))
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.reqHdr != "" {
+				req.Header.Set(tt.reqHdr, "1")
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.code {
+				t.Errorf("status %d; want %d", rr.Code, tt.code)
+			}
+			if got := rr.Body.String(); got != tt.want {
+				t.Errorf("\ngot:  %q\nwant: %q", got, tt.want)
+			}
+			if tt.wantLen && rr.Header().Get("Content-Length") != strconv.Itoa(len(tt.want)) {
+				t.Errorf("Content-Length %q; want %d", rr.Header().Get("Content-Length"), len(tt.want))
+			}
+			if tt.wantLen && !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+				t.Errorf("Content-Type %q", rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestRefreshMiddlewareSSE(t *testing.T) {
+	srv := httptest.NewServer(RefreshMiddleware(http.NotFoundHandler()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + sseEndpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type %q", ct)
+	}
+}
@@ -8,188 +8,1521 @@
 //    go func() {
 //        err := reload.Do(log.Printf)
 //        if err != nil {
-//            panic(err)
+//            log.Print(err)
 //        }
 //    }()
 //
+// Do() returns an error if it can't start watching, and if the watcher stops
+// working and can't be recreated later on; that error is also logged.
+//
 // A list of additional directories to watch can be added:
 //
 //    go func() {
 //        err := reload.Do(log.Printf, reload.Dir("tpl", reloadTpl)
 //        if err != nil {
-//            panic(err)
+//            log.Print(err)
+//        }
+//    }()
+//
+// Restarts can also be triggered with a signal:
+//
+//    go func() {
+//        err := reload.Do(log.Printf, reload.WithSignal(syscall.SIGHUP))
+//        if err != nil {
+//            log.Print(err)
 //        }
 //    }()
 //
 // Note that this package won't prevent race conditions (e.g. when assigning to
-// a global templates variable). You'll need to use sync.RWMutex yourself.
+// a global templates variable). You'll need to use sync.RWMutex yourself, or
+// use Templates() for templates.
 package reload // import "github.com/teamwork/reload"
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
-
-	"github.com/fsnotify/fsnotify"
 )
 
 var (
-	binSelf string
+	// binSelf is the binary we watch for changes, with symlinks resolved;
+	// binLaunch is the path we were started as, and is what we exec. These
+	// differ when the binary is a symlink (e.g. a version manager's shim), in
+	// which case a rebuild replaces the target and the shim should keep
+	// working after a restart. Use binPaths() to read them.
+	binMu              sync.Mutex
+	binSelf, binLaunch string
 
 	// The watcher won't be closed automatically, and the file descriptor will be
-	// leaked if we don't close it in Exec(); see #9.
+	// leaked if we don't close it before restarting; see #9. Do() closes it
+	// before calling any restart function, and Exec() closes it too in case
+	// it's called directly.
 	closeWatcher func() error
 
+	// RestartExec is called to restart the process. The default calls ExecErr()
+	// and logs any errors, rather than panicking.
+	//
+	// Use SetRestart() to change it while Do() is running.
 	RestartExec func()
+	restartMu   sync.Mutex
+
+	// Retry Exec() on ETXTBSY, set by Do().
+	execAttempts    = defaultExecAttempts
+	execRetryWindow = defaultExecRetryWindow
+
+	// Closed to stop Do(), and closed by Do() once it's stopped. Both are nil
+	// if Do() isn't running.
+	runMu           sync.Mutex
+	stopC, stoppedC chan struct{}
+
+	// How often to check Config.CanRestart again after it returned false.
+	canRestartInterval = time.Second
+
+	// Warn about an untested GOOS only once.
+	untestedGOOS sync.Once
 )
 
+// Defaults for Config.ExecAttempts and Config.ExecRetryWindow.
+const (
+	defaultExecAttempts    = 5
+	defaultExecRetryWindow = 2 * time.Second
+)
+
+// ErrAlreadyStarted is returned by Do() if it's already running; use Stop()
+// first to start it again with different options.
+var ErrAlreadyStarted = errors.New("reload.Do: already started")
+
+// Option configures Do; see Dir and the With... functions.
+type Option interface{ apply(*reloader) }
+
+type optionFunc func(*reloader)
+
+func (f optionFunc) apply(r *reloader) { f(r) }
+
+type reloader struct {
+	cfg     Config
+	dirs    []dir
+	signals []os.Signal
+	force   []os.Signal // Subset of signals from WithForceSignal().
+	trigger string      // FIFO from WatchTrigger().
+	args    []func([]string) []string
+
+	preRestart        []string
+	preRestartTimeout time.Duration
+	killChildren      *killChildren
+	restart           RestartFunc
+	shutdownTimeout   time.Duration
+	logger            Logger
+	watcher           Watcher
+	newWatcher        func() (Watcher, error)
+	recorder          Recorder
+	debug             bool
+	dryRun            bool
+	dryRunCallbacks   bool
+	busy              func() bool
+	busyInterval      time.Duration
+	busyMaxHold       time.Duration
+	window            *restartWindow
+	windowErr         error
+	approval          bool
+	approveSignals    []os.Signal
+}
+
 type dir struct {
-	path string
-	cb   func()
+	path      string
+	cb        func()
+	cbFiles   func([]string)
+	cbChanges func([]Change)
+	recursive bool
+	missing   bool          // Doesn't exist yet; see Config.WaitForDirs.
+	pattern   string        // Only files matching this; see Glob().
+	file      string        // Only this file in path, if a file was given to Dir().
+	content   bool          // Also run on startup; see Content().
+	debounce  time.Duration // See Debounce(); 0 is the default.
 }
 
+func (d dir) apply(r *reloader) { r.dirs = append(r.dirs, d) }
+
 // Dir is an additional directory to watch for changes. Directories are watched
 // non-recursively.
 //
+// This can also be a regular file, in which case its directory is watched so
+// that replacing it by renaming a new file over it is noticed; this includes
+// editors that move the old file away first, and removing it.
+//
+// Events are collected until the directory has been quiet for 100ms, and the
+// callback is run once for the entire burst (e.g. a build writing many files);
+// use Debounce() to change this. If the binary changed too, the callback is run
+// before restarting; see Config.SettleWindow.
+//
+// The same path can be added more than once; the callbacks are run in the
+// order they were added.
+//
 // The second argument is the callback that to run when the directory changes.
 // Use reload.Exec() to restart the process.
-func Dir(path string, cb func()) dir { return dir{path, cb} }
+func Dir(path string, cb func()) dir { return dir{path: path, cb: cb} }
+
+// DirFiles is like Dir, but the callback receives the list of all files that
+// changed.
+//
+// Events are collected until the directory has been quiet for 100ms, and the
+// callback is run once for the entire burst (e.g. a build writing many files).
+func DirFiles(path string, cb func(changed []string)) dir {
+	return dir{path: path, cbFiles: cb}
+}
+
+// Change is a file that changed, for DirChanges().
+type Change struct {
+	Path string
+	Op   Op        // The last operation, if it changed more than once.
+	Time time.Time // When the last event for it was received.
+}
+
+// DirChanges is like DirFiles, but the callback receives the operation and
+// time for every file. Every file is listed once, in the order they first
+// changed.
+func DirChanges(path string, cb func(changes []Change)) dir {
+	return dir{path: path, cbChanges: cb}
+}
+
+// WithSignal restarts the process when one of the signals is received, for
+// example "kill -HUP". The restart goes through the same path as a binary
+// change.
+//
+// This can be passed more than once; the signal handler is removed when the
+// watcher is closed.
+func WithSignal(sig ...os.Signal) Option {
+	return optionFunc(func(r *reloader) { r.signals = append(r.signals, sig...) })
+}
 
 // Do reload the current process when its binary changes.
 //
 // The log function is used to display an informational startup message and
-// errors. It works well with e.g. the standard log package or Logrus.
+// errors. It works well with e.g. the standard log package or Logrus. Use
+// WithLogger() to log to a leveled logger instead, in which case the log
+// function can be nil.
 //
-// The error return will only return initialisation errors. Once initialized it
-// will use the log function to print errors, rather than return.
-func Do(log func(string, ...interface{}), additional ...dir) error {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return fmt.Errorf("reload.Do: cannot setup watcher: %w", err)
+// Once initialized errors are printed with the log function rather than
+// returned; use Errors() if you want to act on these errors.
+//
+// Do blocks until Stop() is called, after which it returns nil. It also
+// returns if the watcher stops working and can't be recreated (e.g. because
+// the channels of a watcher from WithWatcher() were closed), in which case
+// the error is a *WatchError; it's also logged and sent to OnError() and
+// Errors() before Do() returns, so don't panic() on errors from Do().
+//
+// Only one Do() can run at a time; it returns ErrAlreadyStarted if it's
+// already running.
+func Do(log func(string, ...interface{}), opts ...Option) error {
+	runMu.Lock()
+	if stopC != nil {
+		runMu.Unlock()
+		return ErrAlreadyStarted
 	}
-	closeWatcher = watcher.Close
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	stopC, stoppedC = stop, stopped
+	runMu.Unlock()
+	defer func() {
+		runMu.Lock()
+		// Also stop anything waiting on the loop if it exited by itself.
+		select {
+		case <-stop:
+		default:
+			close(stop)
+		}
+		stopC, stoppedC = nil, nil
+		runMu.Unlock()
+		setWatched(WatchedPaths{})
+		setPending(nil)
+		close(stopped)
+	}()
 
-	binSelf, err = self()
+	var r reloader
+	for _, o := range opts {
+		o.apply(&r)
+	}
+	if r.windowErr != nil {
+		return fmt.Errorf("reload.Do: %w", r.windowErr)
+	}
+	additional := r.dirs
+	if r.cfg.Verbose {
+		r.debug = true
+	}
+	l := r.logger
+	if l == nil {
+		l = LogFunc(log)
+	}
+	if f, ok := l.(LogFunc); ok && r.debug {
+		l = debugLogFunc{f}
+	}
+	if buildDisabled {
+		l.Infof("reload: not watching anything, as it was built with the reload_disabled tag")
+		return nil
+	}
+	slog, _ := l.(structuredLogger)
+	logger = l
+	argFuncs = r.args
+	killOpts = r.killChildren
+	execAttempts, execRetryWindow, onExitTimeout = defaultExecAttempts, defaultExecRetryWindow, defaultOnExitTimeout
+	if r.cfg.ExecAttempts > 0 {
+		execAttempts = r.cfg.ExecAttempts
+	}
+	if r.cfg.ExecRetryWindow > 0 {
+		execRetryWindow = r.cfg.ExecRetryWindow
+	}
+	if r.cfg.OnExitTimeout > 0 {
+		onExitTimeout = r.cfg.OnExitTimeout
+	}
+	shutdownTimeout = defaultDrainTimeout
+	if r.cfg.DrainTimeout != 0 {
+		shutdownTimeout = r.cfg.DrainTimeout
+	}
+	if r.shutdownTimeout != 0 {
+		shutdownTimeout = r.shutdownTimeout
+	}
+	quietErrors = r.cfg.QuietErrors
+	restartStdio = [3]*os.File{r.cfg.RestartStdin, r.cfg.RestartStdout, r.cfg.RestartStderr}
+	recorder = nopRecorder{}
+	if r.recorder != nil {
+		recorder = r.recorder
+	}
+	if r.cfg.EventWriter != nil {
+		defer startEventWriter(r.cfg.EventWriter)()
+	}
+	dryRunMu.Lock()
+	dryRun, dryRunCallbacks = r.dryRun, r.dryRunCallbacks
+	dryRunMu.Unlock()
+
+	watcher := r.watcher
+	if watcher == nil {
+		if r.newWatcher == nil {
+			r.newWatcher = newFSWatcher
+		}
+		var err error
+		watcher, err = r.newWatcher()
+		if err != nil {
+			return fmt.Errorf("reload.Do: cannot setup watcher: %w", err)
+		}
+	}
+
+	var (
+		sigs        = make(chan os.Signal, 1)
+		approveSigs = make(chan os.Signal, 1)
+	)
+	openEvents()
+	closeFn := func() error {
+		signal.Stop(sigs)
+		signal.Stop(approveSigs)
+		closeEvents()
+		return watcher.Close()
+	}
+	closeWatcher = closeFn
+	started := false
+	defer func() {
+		if !started && closeWatcher != nil {
+			closeWatcher()
+			closeWatcher = nil
+		}
+	}()
+
+	resolve := self
+	if r.cfg.ResolveBinary != nil {
+		resolve = func() (string, error) {
+			p, err := r.cfg.ResolveBinary()
+			if err != nil {
+				return "", fmt.Errorf("reload.Do: cannot resolve binary: %w", err)
+			}
+			return filepath.Abs(p)
+		}
+	}
+	launch, err := resolve()
 	if err != nil {
 		return err
 	}
+	bin := launch
+	if real, err := filepath.EvalSymlinks(launch); err == nil {
+		bin = real
+	}
+	binMu.Lock()
+	binSelf, binLaunch = bin, launch
+	binMu.Unlock()
+	if !r.cfg.IgnoreBinary && isTempBinary(launch, goCache()) {
+		l.Errorf("reload: %q looks like a temporary binary from \"go run\", which isn't rebuilt "+
+			"when the source changes; use \"go build\" or BuildAndReload(), or set "+
+			"Config.IgnoreBinary to silence this warning", relpath(launch))
+	}
 
 	// Watch the directory, because a recompile renames the existing
-	// file (rather than rewriting it), so we won't get events for that.
-	dirs := make([]string, len(additional)+1)
-	dirs[0] = filepath.Dir(binSelf)
+	// file (rather than rewriting it), so we won't get events for that. If
+	// the binary is a symlink we also watch the link's directory, so that
+	// re-pointing the link is noticed.
+	var dirs []string
+	if !r.cfg.IgnoreBinary {
+		dirs = append(dirs, filepath.Dir(bin))
+		if d := filepath.Dir(launch); d != dirs[0] {
+			dirs = append(dirs, d)
+		}
+	}
+	required := len(dirs)
+	binDirs := append([]string{}, dirs...)
+	if r.cfg.SkipDirs == nil {
+		r.cfg.SkipDirs = defaultSkipDirs
+	}
 
-	for i := range additional {
-		path, err := filepath.Abs(additional[i].path)
+	valid := additional[:0]
+	for _, a := range additional {
+		watch, err := r.resolveDir(&a)
 		if err != nil {
-			return fmt.Errorf("reload.Do: cannot get absolute path to %q: %w",
-				additional[i].path, err)
+			if !r.cfg.ContinueOnAddError {
+				return fmt.Errorf("reload.Do: %w", err)
+			}
+			logError(l, &WatchError{Path: a.path, Err: fmt.Errorf("not watching %q: %w", a.path, err)})
+			continue
+		}
+		valid = append(valid, a)
+		dirs = append(dirs, watch...)
+	}
+	additional = valid
+
+	// Drop any Restart() calls from before we started.
+	select {
+	case <-manual:
+	default:
+	}
+
+	// Paths as given to Dir() and friends, for logging and Watched().
+	paths := make([]string, len(additional))
+	for i, a := range additional {
+		paths[i] = a.path
+		if a.file != "" {
+			paths[i] = a.file
+		} else if a.pattern != "" {
+			paths[i] = a.pattern
+		}
+	}
+	w := WatchedPaths{Callbacks: paths}
+	if !r.cfg.IgnoreBinary {
+		w.Binary = bin
+	}
+	setWatched(w)
+
+	// Add to the watcher, and keep track of it for Watched().
+	watchDir := func(d string) error {
+		if err := addWatch(watcher, d); err != nil {
+			return err
+		}
+		addWatched(d)
+		return nil
+	}
+
+	var (
+		watching = make([]string, 0, len(dirs))
+		seen     = make(map[string]bool, len(dirs))
+	)
+	for i, d := range dirs {
+		// The same directory may be added more than once, e.g. with multiple
+		// callbacks.
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		if err := watchDir(d); err != nil {
+			// The binary's directories are always required.
+			if i < required || !r.cfg.ContinueOnAddError {
+				return fmt.Errorf("reload.Do: %w", err)
+			}
+			logError(l, &WatchError{Path: d, Err: err})
+			continue
+		}
+		watching = append(watching, d)
+	}
+
+	// Create a new watcher if we can, and add all directories again.
+	newWatch := func() error {
+		if r.newWatcher != nil {
+			w, err := r.newWatcher()
+			if err != nil {
+				return err
+			}
+			watcher = w
+		}
+
+		add := append([]string{}, watching...)
+		for _, a := range additional {
+			if a.recursive && !a.missing {
+				sub, _ := walkDirs(a.path, 0, r.cfg.MaxDepth, r.cfg.SkipDirs)
+				add = append(add, sub...)
+			}
+		}
+		seen := make(map[string]bool, len(add))
+		for _, d := range add {
+			if seen[d] {
+				continue
+			}
+			seen[d] = true
+			if err := watchDir(d); err != nil {
+				logError(l, &WatchError{Path: d, Err: err})
+			}
+		}
+		return nil
+	}
+
+	// Exec() closes the watcher, so we need to start watching again if it
+	// failed.
+	rewatch := func() {
+		if closeWatcher != nil {
+			return
+		}
+		if r.newWatcher == nil {
+			logError(l, &WatchError{Err: errors.New("not watching after failed restart: " +
+				"the watcher from WithWatcher() was closed and can't be recreated")})
+			return
+		}
+		if err := newWatch(); err != nil {
+			logError(l, &WatchError{Err: fmt.Errorf("not watching after failed restart: %w", err)})
+			return
+		}
+		openEvents()
+		closeWatcher = closeFn
+		if len(r.signals) > 0 {
+			signal.Notify(sigs, r.signals...)
+		}
+		if len(r.approveSignals) > 0 {
+			signal.Notify(approveSigs, r.approveSignals...)
+		}
+	}
+
+	// Recreate the watcher after a fatal error, such as the kernel dropping
+	// the inotify instance. Returns an error if it can't be recreated.
+	// The error is also logged and sent to OnError() and Errors(), as Do()
+	// usually runs in a goroutine that ignores it.
+	recoverWatcher := func(err error) error {
+		if r.newWatcher == nil {
+			err := &WatchError{Err: fmt.Errorf("watcher failed and can't be recreated: %w", err)}
+			logError(l, err)
+			return err
+		}
+
+		l.Errorf("reload: watcher failed: %v; recreating it", err)
+		watcher.Close()
+		delay := 100 * time.Millisecond
+		for i := 1; ; i++ {
+			err := newWatch()
+			if err == nil {
+				l.Infof("reload: recreated watcher")
+				return nil
+			}
+			if i == maxWatchRecreate {
+				err := &WatchError{Err: fmt.Errorf("giving up recreating watcher after %d attempts: %w", i, err)}
+				logError(l, err)
+				return err
+			}
+			select {
+			case <-time.After(delay):
+			case <-stop:
+				return nil
+			}
+			delay *= 2
+		}
+	}
+
+	logRestart := func(reason Reason) {
+		if slog != nil {
+			slog.info("restarting", "path", reason.Path, "op", reason.Op.String(), "reason", reason.Kind.String())
+			return
+		}
+		l.Infof("restarting %q: %s", relpath(bin), reason)
+	}
+	doRestart := func(reason Reason) {
+		countRestart()
+		recorder.RestartTriggered(reason.Path)
+		sendEvent(Event{Kind: RestartScheduled, Path: reason.Path})
+		notifyBeforeRestart(l, reason.String())
+
+		// Restart functions that don't call Exec() would otherwise leak the
+		// watcher. Signals and Events() are left alone, as we keep running if
+		// the restart function returns. A watcher from WithWatcher() can't be
+		// recreated, so it's kept open.
+		if r.newWatcher != nil {
+			watcher.Close()
+		}
+		notifyRestartWait()
+		recoverPanic(l, "", r.cfg.Repanic, func() {
+			switch {
+			case r.restart != nil:
+				r.restart(reason)
+			case r.cfg.Restart != nil:
+				if err := r.cfg.Restart(); err != nil {
+					logError(l, &RestartError{Err: fmt.Errorf("restart failed: %w", err)})
+				}
+			default:
+				restartMu.Lock()
+				fn := RestartExec
+				restartMu.Unlock()
+				fn()
+			}
+		})
+		if closeWatcher != nil {
+			if r.newWatcher == nil {
+				return
+			}
+			if err := newWatch(); err != nil {
+				logError(l, &WatchError{Err: fmt.Errorf("not watching after restart: %w", err)})
+			}
+			return
+		}
+		rewatch()
+	}
+
+	runCallback := func(a dir, changes []Change) {
+		if !Enabled() {
+			return
+		}
+		if dry, callbacks := isDryRun(); dry && !callbacks {
+			l.Infof("reload: dry-run: would run callback for dir=%s", relpath(a.path))
+			return
+		}
+		countDirCallback(a.path)
+		start := time.Now()
+		recoverPanic(l, a.path, r.cfg.Repanic, func() {
+			switch {
+			case a.cbChanges != nil:
+				a.cbChanges(changes)
+			case a.cbFiles != nil:
+				files := make([]string, len(changes))
+				for i, c := range changes {
+					files[i] = c.Path
+				}
+				a.cbFiles(files)
+			default:
+				a.cb()
+			}
+		})
+		took := time.Since(start)
+		recorder.CallbackRan(a.path, changes[0].Path, took)
+		sendEvent(Event{Kind: CallbackRan, Path: a.path, Duration: took})
+	}
+
+	// With Config.AsyncCallbacks the callbacks are run in a new goroutine, and
+	// cbMu makes sure only one runs at a time. Do() waits for them to finish
+	// before returning.
+	var (
+		cbMu sync.Mutex
+		cbWG sync.WaitGroup
+	)
+	runCallbacks := func(run func()) {
+		if !r.cfg.AsyncCallbacks {
+			run()
+			return
+		}
+		cbWG.Add(1)
+		go func() {
+			defer cbWG.Done()
+			cbMu.Lock()
+			defer cbMu.Unlock()
+			run()
+		}()
+	}
+
+	// Disable(), WithRestartWindow(), Config.CanRestart, or WithBusyCheck() may
+	// postpone the restart; try again later. New changes while it's postponed
+	// only update the reason, and don't push back the next try.
+	var (
+		postponed       *time.Timer
+		postponedC      <-chan time.Time // nil if no retry is scheduled.
+		postponedReason Reason
+		postponedAt     time.Time
+	)
+	tryRestart := func(reason Reason) {
+		var (
+			why      string
+			policy   HoldPolicy
+			interval = canRestartInterval
+		)
+		switch {
+		case reason.Kind == BinaryChanged && !Enabled():
+			why, policy = "reload is disabled", HeldByDisabled
+		case r.window != nil && !reason.Force && !r.window.contains(time.Now()):
+			next := r.window.next(time.Now())
+			why, policy = "it's outside the restart window until "+next.Format("15:04 MST"), HeldByWindow
+			interval = time.Until(next)
+		case r.cfg.CanRestart != nil && !r.cfg.CanRestart():
+			why, policy = "CanRestart returned false", HeldByCanRestart
+		case r.busy != nil && r.busy():
+			why, policy = "the busy check returned true", HeldByBusy
+			if r.busyInterval > 0 {
+				interval = r.busyInterval
+			}
+			if r.busyMaxHold > 0 && postponed != nil && time.Since(postponedAt) >= r.busyMaxHold {
+				l.Infof("reload: restarting anyway after waiting %s for the busy check", r.busyMaxHold)
+				why = ""
+			}
+		}
+		if why != "" {
+			if postponed == nil {
+				postponedAt = time.Now()
+			}
+			setPending(&PendingInfo{Reason: reason, Detected: postponedAt, Policy: policy})
+			if postponed == nil {
+				l.Infof("reload: not restarting yet, as %s: %s", why, reason)
+				countStats(func(s *Statistics) { s.RestartPending = true })
+			}
+			postponedReason = reason
+			if postponedC == nil {
+				postponed = time.NewTimer(interval)
+				postponedC = postponed.C
+			}
+			return
+		}
+		setPending(nil)
+		if postponed != nil {
+			postponed.Stop()
+			postponed, postponedC = nil, nil
+			countStats(func(s *Statistics) { s.RestartPending = false })
+		}
+		logRestart(reason)
+		doRestart(reason)
+	}
+
+	var (
+		building, rebuild bool
+		buildReason       Reason
+		built             = make(chan error)
+	)
+	// WithApproval() keeps the binary change until Approve() or Reject().
+	var approvalReason Reason
+	awaitApproval := func(reason Reason) {
+		sum, err := checksum(reason.Path)
+		if err != nil {
+			logError(l, &RestartError{Err: fmt.Errorf("cannot get checksum: %w", err)})
+		}
+		replace, p := Pending()
+		replace = replace && p.Policy == HeldByApproval
+		approvalReason = reason
+		// An approved restart that's still postponed is for an older binary.
+		if postponed != nil {
+			postponed.Stop()
+			postponed, postponedC = nil, nil
+			countStats(func(s *Statistics) { s.RestartPending = false })
+		}
+		setPending(&PendingInfo{Reason: reason, Detected: time.Now(), Policy: HeldByApproval, Checksum: sum})
+		if replace {
+			l.Infof("reload: newer binary detected, replacing the pending restart (checksum %s)", sum)
+		} else {
+			l.Infof("reload: new binary detected, awaiting approval: %s (checksum %s)", reason, sum)
+		}
+	}
+
+	var restartApproved func(Reason)
+	restart := func(reason Reason) {
+		if dry, _ := isDryRun(); dry {
+			l.Infof("reload: dry-run: would restart (path=%s, op=%s): %s", relpath(reason.Path), reason.Op, reason)
+			return
+		}
+		if r.approval && reason.Kind == BinaryChanged {
+			awaitApproval(reason)
+			return
+		}
+		restartApproved(reason)
+	}
+	restartApproved = func(reason Reason) {
+		if len(r.preRestart) == 0 {
+			tryRestart(reason)
+			return
+		}
+		buildReason = reason
+		if building {
+			rebuild = true
+			return
+		}
+		building = true
+		l.Infof("reload: running %q before restarting: %s", strings.Join(r.preRestart, " "), reason)
+		go func() {
+			err := runCommand(l, r.preRestart, r.preRestartTimeout)
+			select {
+			case built <- err:
+			case <-stop:
+			}
+		}()
+	}
+
+	// Pending callbacks for a directory, which are run once it's been quiet
+	// for the callbacks' Debounce() period.
+	type batchKey struct {
+		dir      string
+		debounce time.Duration
+	}
+	type batch struct {
+		key     batchKey
+		changes map[int][]Change // Changed files, by index in additional.
+		timer   *time.Timer
+	}
+	var (
+		batches = make(map[batchKey]*batch)
+		flush   = make(chan *batch)
+	)
+	runBatch := func(b *batch) {
+		delete(batches, b.key)
+		var run []dir // Copy, as additional can change while they run.
+		var changes [][]Change
+		for i, a := range additional {
+			if c, ok := b.changes[i]; ok {
+				run, changes = append(run, a), append(changes, c)
+			}
+		}
+		if r.cfg.OnChange != nil {
+			seen := make(map[string]bool)
+			for _, cs := range changes {
+				for _, c := range cs {
+					if !seen[c.Path] {
+						seen[c.Path] = true
+						r.cfg.OnChange(c.Path, c.Op)
+					}
+				}
+			}
+		}
+		runCallbacks(func() {
+			for i, a := range run {
+				runCallback(a, changes[i])
+			}
+		})
+	}
+
+	// Run the callbacks for all pending changes to completion, without waiting
+	// for the directories to be quiet, so the new process sees their results.
+	flushBatches := func() {
+		if len(batches) == 0 {
+			return
+		}
+		var (
+			run   []*batch
+			names []string
+		)
+		for _, a := range additional {
+			if b, ok := batches[batchKey{a.path, a.debounce}]; ok {
+				b.timer.Stop()
+				delete(batches, b.key)
+				run, names = append(run, b), append(names, relpath(a.path))
+			}
+		}
+		l.Infof("reload: running callbacks for %s before restarting", strings.Join(names, ", "))
+		for _, b := range run {
+			runBatch(b)
+		}
+		cbWG.Wait()
+	}
+
+	var (
+		binChanged time.Time
+		binReason  Reason
+		binModTime time.Time // For Config.CheckModTime.
+		settle     *time.Timer
+		settleC    <-chan time.Time // nil if no restart is pending.
+
+		binDirMissing []string
+		binDirPoll    *time.Ticker
+		binDirPollC   <-chan time.Time // nil if all of binDirs exist.
+	)
+
+	// Wait for writes to finish before restarting; every new event resets the
+	// timer.
+	settleWindow := r.cfg.SettleWindow
+	if settleWindow == 0 {
+		settleWindow = 100 * time.Millisecond
+	}
+	binaryChanged := func(reason Reason) {
+		binChanged = time.Now()
+		binReason = reason
+		if settle != nil {
+			settle.Stop()
+		}
+		settle = time.NewTimer(settleWindow)
+		settleC = settle.C
+	}
+
+	// The binary's directory may be removed, e.g. if it's in a temporary
+	// directory. The watch is gone when that happens, so poll until it's
+	// created again.
+	removedBinDir := func(path string) bool {
+		if !contains(binDirs, path) || contains(binDirMissing, path) {
+			return false
+		}
+		if _, err := os.Stat(path); err == nil {
+			return false
+		}
+		logError(l, &WatchError{Path: path, Err: fmt.Errorf(
+			"directory of the binary %q was removed; not reloading until it's created again", path)})
+		binDirMissing = append(binDirMissing, path)
+		countStats(func(s *Statistics) { s.BinaryDirMissing = true })
+		if binDirPoll == nil {
+			binDirPoll = time.NewTicker(binDirPollInterval)
+			binDirPollC = binDirPoll.C
+		}
+		return true
+	}
+
+	// Watch new subdirectories for DirRecursive().
+	addRecursive := func(path string) {
+		for _, a := range additional {
+			if !a.recursive || !inDir(path, a.path) {
+				continue
+			}
+			if s, err := os.Stat(path); err != nil || !s.IsDir() {
+				return
+			}
+			if contains(r.cfg.SkipDirs, filepath.Base(path)) {
+				return
+			}
+			sub, err := walkDirs(path, pathDepth(a.path, path), r.cfg.MaxDepth, r.cfg.SkipDirs)
+			if err != nil {
+				logError(l, &WatchError{Path: path, Err: err})
+			}
+			for _, d := range sub {
+				if err := watchDir(d); err != nil {
+					logError(l, &WatchError{Path: d, Err: err})
+				}
+			}
+			return
 		}
+	}
 
-		s, err := os.Stat(path)
+	// Start watching directories from Config.WaitForDirs once they're created;
+	// returns true if any callbacks were run.
+	addMissing := func(path string) bool {
+		ran := false
+		for i := range additional {
+			a := &additional[i]
+			if !a.missing || !inDir(a.path, path) {
+				continue
+			}
+
+			// Parent directory was created; watch that for the next level.
+			if _, err := os.Stat(a.path); err != nil {
+				if err := watchDir(path); err != nil {
+					logError(l, &WatchError{Path: path, Err: err})
+				}
+				continue
+			}
+
+			watch, err := r.resolveDir(a)
+			if err != nil {
+				logError(l, &WatchError{Path: a.path, Err: fmt.Errorf("not watching %q: %w", a.path, err)})
+				continue
+			}
+			a.missing = false
+			for _, d := range watch {
+				if err := watchDir(d); err != nil {
+					logError(l, &WatchError{Path: d, Err: err})
+				}
+			}
+			l.Infof("reload: %q was created; watching it now", relpath(a.path))
+
+			// Files may have been written before we started watching.
+			d, changes := *a, []Change{{Path: a.path, Op: OpCreate, Time: time.Now()}}
+			runCallbacks(func() { runCallback(d, changes) })
+			ran = true
+		}
+		return ran
+	}
+
+	if r.trigger != "" {
+		stopTrigger, err := watchTrigger(r.trigger)
 		if err != nil {
 			return fmt.Errorf("reload.Do: %w", err)
 		}
-		if !s.IsDir() {
-			return fmt.Errorf("reload.Do: not a directory: %q; can only watch directories",
-				additional[i].path)
+		defer stopTrigger()
+	}
+
+	add := ""
+	if len(additional) > 0 {
+		reldirs := make([]string, len(additional))
+		for i, a := range additional {
+			reldirs[i] = relpath(a.path)
+			if a.file != "" {
+				reldirs[i] = relpath(a.file)
+			} else if a.pattern != "" {
+				reldirs[i] = relpath(a.pattern)
+			} else if a.recursive {
+				reldirs[i] += " (recursive)"
+			}
+		}
+		add = fmt.Sprintf(" (additional dirs: %s)", strings.Join(reldirs, ", "))
+	}
+	if len(r.signals) > 0 {
+		signal.Notify(sigs, r.signals...)
+		names := make([]string, len(r.signals))
+		for i := range r.signals {
+			names[i] = r.signals[i].String()
 		}
+		add += fmt.Sprintf(" (or on signal: %s)", strings.Join(names, ", "))
+	}
+	if r.trigger != "" {
+		add += fmt.Sprintf(" (or on write to %q)", relpath(r.trigger))
+	}
+	if r.approval {
+		add += " (after approval)"
+	}
+	if len(r.approveSignals) > 0 {
+		signal.Notify(approveSigs, r.approveSignals...)
+	}
+	if t, ok := LastReload(); ok {
+		add += fmt.Sprintf(" (generation %d, reloaded in %s)", Generation(), time.Since(t).Round(time.Millisecond))
+	}
+	if slog != nil {
+		kv := []interface{}{"binary", bin, "dirs", paths, "generation", Generation()}
+		if r.cfg.IgnoreBinary {
+			kv = append(kv, "ignore_binary", true)
+		}
+		slog.info("watching", kv...)
+	} else if r.cfg.IgnoreBinary {
+		l.Infof("not restarting %q when it changes%s", relpath(bin), add)
+	} else {
+		l.Infof("restarting %q when it changes%s", relpath(bin), add)
+	}
+	// Read the initial contents for Content() once we're watching, so that no
+	// changes are missed.
+	for _, a := range additional {
+		if a.content {
+			recoverPanic(l, a.path, r.cfg.Repanic, func() { a.cbChanges(nil) })
+		}
+	}
+	if r.cfg.OnStart != nil {
+		r.cfg.OnStart(watching)
+	}
+
+	// Ensure that we use the correct events, as they are not uniform accross
+	// platforms. See https://github.com/fsnotify/fsnotify/issues/74
+	triggerOp := r.cfg.TriggerOp
+	if triggerOp == 0 {
+		triggerOp = defaultTriggerOp(l)
+	}
+
+	grace := r.cfg.StartupGrace
+	if grace == 0 && r.watcher == nil {
+		grace = 500 * time.Millisecond
+	}
+	startedAt := time.Now()
+	if st, err := os.Stat(bin); err == nil {
+		binModTime = st.ModTime()
+	}
+	var binSum string // For Config.SkipUnchangedBinary.
+	if r.cfg.SkipUnchangedBinary {
+		var err error
+		binSum, err = checksum(bin)
+		if err != nil {
+			logError(l, &WatchError{Path: bin, Err: fmt.Errorf("cannot get checksum: %w", err)})
+		}
+	}
 
-		additional[i].path = path
-		dirs[i+1] = path
+	var throttle *errorThrottle
+	if r.cfg.ThrottleErrors {
+		throttle = newErrorThrottle()
 	}
 
-	done := make(chan bool)
+	var (
+		done    = make(chan struct{})
+		exitErr error
+	)
 	go func() {
+		defer close(done)
+		defer cbWG.Wait()
+		defer throttle.flush(l)
+		defer func() {
+			if settle != nil {
+				settle.Stop()
+			}
+			if binDirPoll != nil {
+				binDirPoll.Stop()
+			}
+			if postponed != nil {
+				postponed.Stop()
+				countStats(func(s *Statistics) { s.RestartPending = false })
+			}
+			for _, b := range batches {
+				b.timer.Stop()
+			}
+		}()
 		for {
 			select {
-			case err := <-watcher.Errors:
-				log("reload error: %v", err)
-			case event := <-watcher.Events:
-				// Ensure that we use the correct events, as they are not uniform accross
-				// platforms. See https://github.com/fsnotify/fsnotify/issues/74
-				var trigger bool
-				switch runtime.GOOS {
-				case "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
-					trigger = event.Op&fsnotify.Create == fsnotify.Create
-				case "linux":
-					trigger = event.Op&fsnotify.Write == fsnotify.Write
+			case <-stop:
+				return
+			case <-settleC:
+				settleC = nil
+				if !Enabled() {
+					l.Debugf("reload: not restarting: disabled")
+					continue
+				}
+				// The build may have failed and removed the binary.
+				st, err := os.Stat(bin)
+				if err != nil {
+					logError(l, &RestartError{Err: fmt.Errorf("not restarting: %w", err)})
+					continue
+				}
+				if r.cfg.CheckModTime {
+					if !st.ModTime().After(binModTime) {
+						l.Debugf("reload: not restarting: %q wasn't modified since %s",
+							relpath(bin), binModTime.Format(time.RFC3339Nano))
+						continue
+					}
+					binModTime = st.ModTime()
+				}
+				if r.cfg.SkipUnchangedBinary && binSum != "" {
+					sum, err := checksum(bin)
+					if err != nil {
+						logError(l, &RestartError{Err: fmt.Errorf("cannot get checksum: %w", err)})
+					} else if sum == binSum {
+						l.Infof("reload: binary unchanged, skipping restart: %s", binReason)
+						continue
+					}
+				}
+				flushBatches()
+				if r.cfg.OnChange != nil {
+					r.cfg.OnChange(binReason.Path, binReason.Op)
+				}
+				restart(binReason)
+			case <-postponedC:
+				postponedC = nil
+				tryRestart(postponedReason)
+			case <-binDirPollC:
+				missing := binDirMissing[:0]
+				for _, d := range binDirMissing {
+					if _, err := os.Stat(d); err != nil {
+						missing = append(missing, d)
+						continue
+					}
+					if err := watchDir(d); err != nil {
+						logError(l, &WatchError{Path: d, Err: err})
+						missing = append(missing, d)
+						continue
+					}
+					l.Infof("reload: %q was created again; watching it now", relpath(d))
+				}
+				binDirMissing = missing
+				if len(binDirMissing) > 0 {
+					continue
+				}
+				binDirPoll.Stop()
+				binDirPoll, binDirPollC = nil, nil
+				countStats(func(s *Statistics) { s.BinaryDirMissing = false })
+
+				// The binary was probably rebuilt.
+				if _, err := os.Stat(bin); err == nil {
+					binaryChanged(Reason{Kind: BinaryChanged, Path: bin, Op: OpCreate})
+				}
+			case b := <-flush:
+				if batches[b.key] != b { // Already run by flushBatches().
+					continue
+				}
+				runBatch(b)
+			case err, ok := <-watcher.Errors():
+				if !ok {
+					if exitErr = recoverWatcher(errors.New("error channel closed")); exitErr != nil {
+						return
+					}
+					continue
+				}
+				countWatcherError()
+				if isFatal(err) {
+					if exitErr = recoverWatcher(err); exitErr != nil {
+						return
+					}
+					continue
+				}
+				logWatchError(l, err, throttle)
+			case sig := <-sigs:
+				reason := Reason{Kind: Signal, Signal: sig}
+				for _, f := range r.force {
+					reason.Force = reason.Force || f == sig
+				}
+				restart(reason)
+			case reason := <-manual:
+				restart(reason)
+			case sig := <-approveSigs:
+				if ok, p := Pending(); !ok || p.Policy != HeldByApproval {
+					l.Infof("reload: received signal %s, but no restart is pending", sig)
+					continue
+				}
+				l.Infof("reload: restart approved by signal %s", sig)
+				setPending(nil)
+				restartApproved(approvalReason)
+			case ok := <-approvals:
+				has, p := Pending()
+				if !has || p.Policy != HeldByApproval {
+					continue
+				}
+				setPending(nil)
+				if !ok {
+					l.Infof("reload: rejected the pending restart of %q (checksum %s)", relpath(p.Reason.Path), p.Checksum)
+					continue
+				}
+				l.Infof("reload: restart approved")
+				restartApproved(approvalReason)
+			case err := <-built:
+				building = false
+				switch {
+				case rebuild:
+					rebuild = false
+					restartApproved(buildReason)
+				case err != nil:
+					logError(l, &RestartError{Err: fmt.Errorf("not restarting: %w", err)})
 				default:
-					trigger = event.Op&fsnotify.Create == fsnotify.Create
-					log("reload: untested GOOS %q; this package may not work correctly", runtime.GOOS)
+					tryRestart(buildReason)
+				}
+			case event, ok := <-watcher.Events():
+				if !ok {
+					if exitErr = recoverWatcher(errors.New("event channel closed")); exitErr != nil {
+						return
+					}
+					continue
+				}
+				countEvent()
+				if r.debug {
+					l.Debugf("reload: event %s %q", event.Op, event.Name)
+				}
+				if event.Op&(OpRemove|OpRename) != 0 {
+					// The watcher drops removed directories by itself.
+					removeWatched(event.Name)
+					if removedBinDir(event.Name) {
+						continue
+					}
+				}
+				trigger := event.Op&triggerOp != 0
+				if event.Op&OpCreate == OpCreate {
+					addRecursive(event.Name)
+					if addMissing(event.Name) {
+						continue
+					}
 				}
 
+				if !Enabled() {
+					l.Debugf("reload: ignoring change to %q: disabled", relpath(event.Name))
+					continue
+				}
+				// Files are often replaced by renaming a new file over them,
+				// which is only a create event, or by moving the old file
+				// away first (e.g. vim). The events for a save are collected
+				// in one batch, so the callback only sees the result.
+				if !trigger && event.Op&(OpCreate|OpRemove|OpRename) != 0 {
+					for _, a := range additional {
+						if a.file == event.Name {
+							trigger = true
+						}
+					}
+				}
 				if !trigger {
+					if r.debug {
+						l.Debugf("reload: ignored %q: wrong op %s", event.Name, event.Op)
+					}
+					continue
+				}
+				if grace > 0 && time.Since(startedAt) < grace {
+					l.Infof("reload: ignoring change to %q: within startup grace period of %s",
+						relpath(event.Name), grace)
 					continue
 				}
 
-				if event.Name == binSelf {
-					// Wait for writes to finish.
-					time.Sleep(100 * time.Millisecond)
-					RestartExec()
+				matched := false
+				if !r.cfg.IgnoreBinary && (event.Name == bin || event.Name == launch) {
+					matched = true
+					if r.debug {
+						l.Debugf("reload: triggered %q: binary", event.Name)
+					}
+					sendEvent(Event{Kind: BinaryChange, Path: event.Name, Op: event.Op})
+					binaryChanged(Reason{Kind: BinaryChanged, Path: event.Name, Op: event.Op})
 				}
 
-				for _, a := range additional {
-					if strings.HasPrefix(event.Name, a.path) {
-						time.Sleep(100 * time.Millisecond)
-						a.cb()
+				for i, a := range additional {
+					if a.missing || !inDir(event.Name, a.path) {
+						continue
+					}
+					if a.file != "" && event.Name != a.file {
+						continue
+					}
+					matched = true
+					if a.pattern != "" && !matchGlob(a.pattern, event.Name) {
+						if r.debug {
+							l.Debugf("reload: ignored %q: doesn't match %q", event.Name, a.pattern)
+						}
+						continue
+					}
+					if r.debug {
+						l.Debugf("reload: triggered %q: dir %q", event.Name, a.path)
+					}
+					countDirEvent(a.path)
+					sendEvent(Event{Kind: DirChange, Path: event.Name, Op: event.Op})
+					if s := r.cfg.SuppressCallbacksAfterRestart; s > 0 && time.Since(binChanged) < s {
+						l.Infof("reload: ignoring change to %q: binary changed %s ago",
+							relpath(event.Name), time.Since(binChanged).Round(time.Millisecond))
+						continue
 					}
+
+					// Wait for writes to finish, and run the callbacks once
+					// for a burst of changes.
+					wait, key := a.debounce, batchKey{a.path, a.debounce}
+					if wait == 0 {
+						wait = defaultDebounce
+					}
+					b, ok := batches[key]
+					if !ok {
+						b = &batch{key: key, changes: make(map[int][]Change)}
+						b.timer = time.AfterFunc(wait, func() {
+							select {
+							case flush <- b:
+							case <-stop:
+							}
+						})
+						batches[key] = b
+					} else if b.timer.Stop() {
+						b.timer.Reset(wait)
+					} // Else it already fired and will pick up this path.
+					b.changes[i] = addChange(b.changes[i], Change{Path: event.Name, Op: event.Op, Time: time.Now()})
+				}
+				if !matched && r.debug {
+					l.Debugf("reload: ignored %q: not a watched prefix", event.Name)
 				}
 			}
 		}
 	}()
 
-	for _, d := range dirs {
-		if err := watcher.Add(d); err != nil {
-			return fmt.Errorf("reload.Do: cannot add %q to watcher: %w", d, err)
+	started = true
+	<-done
+
+	if closeWatcher != nil {
+		closeWatcher()
+		closeWatcher = nil
+	}
+	return exitErr
+}
+
+// SetRestart sets RestartExec; unlike assigning it directly this is safe to
+// call while Do() is running.
+func SetRestart(fn func()) {
+	restartMu.Lock()
+	defer restartMu.Unlock()
+	RestartExec = fn
+}
+
+// Get the operation that means a file changed for this GOOS.
+func defaultTriggerOp(l Logger) Op {
+	switch runtime.GOOS {
+	case "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+		return OpCreate
+	case "linux":
+		return OpWrite
+	default:
+		untestedGOOS.Do(func() {
+			l.Errorf("reload: untested GOOS %q; this package may not work correctly; "+
+				"set Config.TriggerOp to silence this warning", runtime.GOOS)
+		})
+		return OpCreate
+	}
+}
+
+// Stop stops Do(), and waits for it to return. It does nothing if Do() isn't
+// running.
+//
+// This must not be called from a Dir() callback, as Do() waits for the
+// callback to return.
+func Stop() {
+	runMu.Lock()
+	if stopC == nil {
+		runMu.Unlock()
+		return
+	}
+	select {
+	case <-stopC:
+	default:
+		close(stopC)
+	}
+	stopped := stoppedC
+	runMu.Unlock()
+	<-stopped
+}
+
+// Add c to changes, or update it if the path is already in there.
+func addChange(changes []Change, c Change) []Change {
+	for i := range changes {
+		if changes[i].Path == c.Path {
+			changes[i] = c
+			return changes
 		}
 	}
+	return append(changes, c)
+}
 
-	add := ""
-	if len(additional) > 0 {
-		reldirs := make([]string, len(dirs)-1)
-		for i := range dirs[1:] {
-			reldirs[i] = relpath(dirs[i+1])
+// Get the closest parent directory of path that exists.
+func existingParent(path string) string {
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return parent
 		}
-		add = fmt.Sprintf(" (additional dirs: %s)", strings.Join(reldirs, ", "))
+		if s, err := os.Stat(parent); err == nil && s.IsDir() {
+			return parent
+		}
+		path = parent
 	}
-	log("restarting %q when it changes%s", relpath(binSelf), add)
-	<-done
-	return nil
+}
+
+// Make the path absolute and get all directories to watch for it.
+func (r *reloader) resolveDir(d *dir) ([]string, error) {
+	path, err := filepath.Abs(d.path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get absolute path to %q: %w", d.path, err)
+	}
+	if d.file != "" {
+		if d.file, err = filepath.Abs(d.file); err != nil {
+			return nil, fmt.Errorf("cannot get absolute path to %q: %w", d.file, err)
+		}
+	}
+	if d.pattern != "" {
+		if err := checkGlob(d.pattern); err != nil {
+			return nil, err
+		}
+		if d.pattern, err = filepath.Abs(d.pattern); err != nil {
+			return nil, fmt.Errorf("cannot get absolute path to %q: %w", d.pattern, err)
+		}
+	}
+
+	s, err := os.Stat(path)
+	if err != nil {
+		if !os.IsNotExist(err) || !r.cfg.WaitForDirs {
+			return nil, err
+		}
+		// Watch the closest parent that does exist, so we know when it's
+		// created.
+		d.path, d.missing = path, true
+		return []string{existingParent(path)}, nil
+	}
+	if s.Mode().IsRegular() && !d.recursive {
+		d.path, d.file = filepath.Dir(path), path
+		return []string{d.path}, nil
+	}
+	if !s.IsDir() {
+		return nil, fmt.Errorf("not a directory or regular file: %q", d.path)
+	}
+
+	d.path = path
+	if !d.recursive {
+		return []string{path}, nil
+	}
+	return walkDirs(path, 0, r.cfg.MaxDepth, r.cfg.SkipDirs)
 }
 
 // Exec replaces the current process with a new copy of itself.
+//
+// The RELOAD_GENERATION and RELOAD_STARTED_AT environment variables are set for
+// the new process; use WasReloaded() and Generation() to read them.
+//
+// This will panic if the process can't be replaced; use ExecErr() to get an
+// error instead.
 func Exec() {
-	execName := binSelf
+	if buildDisabled {
+		return
+	}
+	if err := ExecErr(); err != nil {
+		panic(err.Error())
+	}
+}
+
+// ExecErr is like Exec(), but returns an error instead of panicking. It never
+// returns if the process was replaced.
+func ExecErr() error {
+	if buildDisabled {
+		return errors.New("reload: cannot restart: built with the reload_disabled tag")
+	}
+	_, execName := binPaths()
 	if execName == "" {
 		selfName, err := self()
 		if err != nil {
-			panic(fmt.Sprintf("cannot restart: cannot find self: %v", err))
+			return fmt.Errorf("cannot restart: cannot find self: %w", err)
 		}
 		execName = selfName
 	}
 
+	// Check before closing the watcher, so that Do() keeps watching if the
+	// binary is missing.
+	if err := checkBinary(execName); err != nil {
+		return fmt.Errorf("cannot restart: %w", err)
+	}
+
+	beforeRestart(logger, true)
 	if closeWatcher != nil {
 		closeWatcher()
+		closeWatcher = nil
+	}
+
+	var (
+		argv  = append([]string{execName}, execArgs()...)
+		env   = execEnv()
+		delay = execRetryWindow
+		err   error
+	)
+	if execAttempts > 1 {
+		delay /= time.Duration(1<<uint(execAttempts-1) - 1)
+	}
+	for i := 0; i < execAttempts; i++ {
+		// The binary may still be changing; check every time.
+		if err := checkBinary(execName); err != nil {
+			return fmt.Errorf("cannot restart: %w", err)
+		}
+
+		err = syscall.Exec(execName, argv, env)
+		// ETXTBSY means something still has the file open for writing.
+		if !errors.Is(err, syscall.ETXTBSY) && !errors.Is(err, syscall.EAGAIN) {
+			break
+		}
+		if i < execAttempts-1 {
+			logger.Errorf("reload: cannot restart: %v; retrying in %s", err, delay.Round(time.Millisecond))
+			time.Sleep(delay)
+			delay *= 2
+		}
 	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return fmt.Errorf("cannot restart %q: %w (errno %d)", execName, err, int(errno))
+	}
+	return fmt.Errorf("cannot restart %q: %w", execName, err)
+}
 
-	err := syscall.Exec(execName, append([]string{execName}, os.Args[1:]...), os.Environ())
+// Check that the binary looks executable.
+func checkBinary(path string) error {
+	st, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("binary %q doesn't exist; it was removed or renamed: %w", path, err)
+	}
 	if err != nil {
-		panic(fmt.Sprintf("cannot restart: %v", err))
+		return err
+	}
+	if !st.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file: %q", path)
+	}
+	if runtime.GOOS != "windows" && st.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("not executable: %q", path)
 	}
+	return nil
+}
+
+// Get binSelf and binLaunch; these are empty if Do() wasn't called.
+func binPaths() (self, launch string) {
+	binMu.Lock()
+	defer binMu.Unlock()
+	return binSelf, binLaunch
 }
 
 // Get location to executable.
 func self() (string, error) {
 	bin := os.Args[0]
 	if !filepath.IsAbs(bin) {
-		var err error
-		bin, err = os.Executable()
-		if err != nil {
+		bin = startExe
+		if err := startExeErr; err != nil {
 			return "", fmt.Errorf(
 				"cannot get path to binary %q (launch with absolute path): %w",
 				os.Args[0], err)
@@ -198,20 +1531,73 @@ func self() (string, error) {
 	return bin, nil
 }
 
-// Get path relative to cwd.
+// The path to the binary when the process started. On Linux os.Executable()
+// reads /proc/self/exe, which points to the old inode with " (deleted)" added
+// once "go build" renamed a new binary over it, so get it before that happens.
+var startExe, startExeErr = executable()
+
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return trimDeleted(exe), nil
+}
+
+func trimDeleted(exe string) string {
+	if runtime.GOOS != "linux" {
+		return exe
+	}
+	return strings.TrimSuffix(exe, " (deleted)")
+}
+
+// Report if path is dir or inside it.
+func inDir(path, dir string) bool {
+	return hasPathPrefix(path, dir, filepath.Separator)
+}
+
+func hasPathPrefix(path, dir string, sep byte) bool {
+	if !strings.HasPrefix(path, dir) {
+		return false
+	}
+	// dir may end with a separator if it's the root.
+	return len(path) == len(dir) || path[len(dir)] == sep || (dir != "" && dir[len(dir)-1] == sep)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Get path relative to cwd, if it's in or near cwd.
 func relpath(p string) string {
 	cwd, err := os.Getwd()
 	if err != nil {
 		return p
 	}
 
-	if strings.HasPrefix(p, cwd) {
-		return "./" + strings.TrimLeft(p[len(cwd):], "/")
+	rel, err := filepath.Rel(cwd, p)
+	if err != nil {
+		return p
 	}
-
-	return p
+	// Prefer the absolute path over "../../foo".
+	if strings.HasPrefix(rel, ".."+string(filepath.Separator)+"..") {
+		return p
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel
+	}
+	return "." + string(filepath.Separator) + rel
 }
 
 func init() {
-	RestartExec = Exec
+	RestartExec = func() {
+		if err := ExecErr(); err != nil {
+			logError(logger, &RestartError{Err: err})
+		}
+	}
 }
@@ -0,0 +1,56 @@
+package reload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExecRetryTextBusy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	bin := filepath.Join(tmp, "true")
+	if err := ioutil.WriteFile(bin, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Keep it open for writing, like a deploy script that's still copying.
+	fp, err := os.OpenFile(bin, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+
+	oldBin, oldClose := binLaunch, closeWatcher
+	oldAttempts, oldWindow := execAttempts, execRetryWindow
+	defer func() {
+		binLaunch, closeWatcher = oldBin, oldClose
+		execAttempts, execRetryWindow = oldAttempts, oldWindow
+	}()
+	binLaunch, closeWatcher = bin, nil
+	execAttempts, execRetryWindow = 3, 90*time.Millisecond
+
+	start := time.Now()
+	err = ExecErr()
+	if !errorContains(err, fmt.Sprintf("cannot restart %q: text file busy (errno 26)", bin)) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if took := time.Since(start); took < 90*time.Millisecond {
+		t.Errorf("didn't retry; took %s", took)
+	}
+}
+
+func TestExecutableDeleted(t *testing.T) {
+	if got := trimDeleted("/srv/app (deleted)"); got != "/srv/app" {
+		t.Errorf("got %q", got)
+	}
+	if startExeErr != nil || filepath.Base(startExe) != filepath.Base(os.Args[0]) {
+		t.Errorf("startExe = %q, %v", startExe, startExeErr)
+	}
+}
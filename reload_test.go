@@ -1,7 +1,20 @@
 package reload
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -13,8 +26,1579 @@ func TestLog(t *testing.T) {
 			panic(err)
 		}
 	}()
+	defer Stop()
 
 	time.Sleep(1 * time.Second)
 
 	// TODO: maybe write some meaningful tests?
 }
+
+func TestDirFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	changed := make(chan []string, 2)
+	go func() {
+		err := Do(log.Printf, DirFiles(tmp, func(c []string) { changed <- c }), Config{StartupGrace: -1})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, f := range []string{"a", "b", "c", "a"} {
+		err := ioutil.WriteFile(filepath.Join(tmp, f), []byte("x"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case c := <-changed:
+		sort.Strings(c)
+		want := []string{filepath.Join(tmp, "a"), filepath.Join(tmp, "b"), filepath.Join(tmp, "c")}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("\nout:  %v\nwant: %v", c, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback not run")
+	}
+	select {
+	case c := <-changed:
+		t.Errorf("callback run twice: %v", c)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestRelpath(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := filepath.Dir(cwd)
+
+	tests := []struct {
+		in, want string
+	}{
+		{cwd, "."},
+		{filepath.Join(cwd, "a", "b"), "." + string(filepath.Separator) + filepath.Join("a", "b")},
+		{cwd + "bar", filepath.Join("..", filepath.Base(cwd)+"bar")},
+		{filepath.Join(parent, "x"), filepath.Join("..", "x")},
+		{parent, ".."},
+		{filepath.Join(filepath.Dir(parent), "x"), filepath.Join(filepath.Dir(parent), "x")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out := relpath(tt.in)
+			if out != tt.want {
+				t.Errorf("\nout:  %q\nwant: %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecErr(t *testing.T) {
+	oldBin, oldClose := binLaunch, closeWatcher
+	defer func() { binLaunch, closeWatcher = oldBin, oldClose }()
+	closed := false
+	binLaunch = filepath.Join(os.TempDir(), "reload-does-not-exist")
+	closeWatcher = func() error { closed = true; return nil }
+
+	err := ExecErr()
+	if !errorContains(err, "cannot restart: binary \""+binLaunch+"\" doesn't exist") {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if closed {
+		t.Error("watcher closed")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Exec() didn't panic")
+		}
+	}()
+	Exec()
+}
+
+func errorContains(out error, want string) bool {
+	if out == nil {
+		return want == ""
+	}
+	if want == "" {
+		return false
+	}
+	return strings.Contains(out.Error(), want)
+}
+
+func TestContinueOnAddError(t *testing.T) {
+	missing := filepath.Join(os.TempDir(), "reload-does-not-exist")
+
+	err := Do(log.Printf, WithWatcher(newFakeWatcher()), Dir(missing, func() {}))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	logged := make(chan string, 10)
+	go func() {
+		err := Do(func(f string, a ...interface{}) { logged <- fmt.Sprintf(f, a...) },
+			WithWatcher(newFakeWatcher()),
+			Dir(missing, func() {}),
+			Config{ContinueOnAddError: true})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	want := []string{"reload error: not watching", "restarting"}
+	for _, w := range want {
+		select {
+		case l := <-logged:
+			if !strings.HasPrefix(l, w) {
+				t.Errorf("\nout:  %q\nwant: %q", l, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("nothing logged; want %q", w)
+		}
+	}
+}
+
+func TestCloseOnInitError(t *testing.T) {
+	w := newFakeWatcher()
+	err := Do(log.Printf, WithWatcher(w), Dir(filepath.Join(os.TempDir(), "reload-does-not-exist"), func() {}))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if !w.Closed() {
+		t.Error("watcher not closed")
+	}
+	if closeWatcher != nil {
+		t.Error("closeWatcher not reset")
+	}
+}
+
+func TestWaitForDirs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		sub    = filepath.Join(tmp, "dist", "sub")
+		called = make(chan struct{}, 10)
+	)
+	go func() {
+		err := Do(log.Printf, Dir(sub, func() { called <- struct{}{} }), Config{WaitForDirs: true, StartupGrace: -1})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	wait := func(what string) {
+		t.Helper()
+		select {
+		case <-called:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("callback not run after %s", what)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Dir(sub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wait("creating directory")
+
+	if err := ioutil.WriteFile(filepath.Join(sub, "file"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wait("writing file")
+}
+
+func TestOnStart(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w       = newFakeWatcher()
+		started = make(chan []string, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), Dir(tmp, func() {}),
+			Config{OnStart: func(dirs []string) { started <- dirs }})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	select {
+	case dirs := <-started:
+		if len(dirs) != 2 || dirs[1] != tmp {
+			t.Errorf("wrong dirs: %q", dirs)
+		}
+		if added := w.Added(); !reflect.DeepEqual(dirs, added) {
+			t.Errorf("\ndirs:  %q\nadded: %q", dirs, added)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnStart not called")
+	}
+}
+
+func TestStop(t *testing.T) {
+	Stop() // Does nothing if not running.
+
+	for i := 0; i < 2; i++ {
+		var (
+			started = make(chan struct{})
+			ret     = make(chan error, 1)
+		)
+		go func() {
+			ret <- Do(log.Printf, WithWatcher(newFakeWatcher()),
+				Config{OnStart: func([]string) { close(started) }})
+		}()
+		<-started
+
+		if err := Do(log.Printf, WithWatcher(newFakeWatcher())); err != ErrAlreadyStarted {
+			t.Errorf("wrong error: %v", err)
+		}
+
+		Stop()
+		select {
+		case err := <-ret:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Do() didn't return after Stop()")
+		}
+	}
+}
+
+func TestStopLeak(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		var (
+			started = make(chan struct{})
+			ret     = make(chan error, 1)
+		)
+		// Use the fsnotify watcher, as it starts goroutines too.
+		go func() {
+			ret <- Do(log.Printf, DirRecursive(tmp, func() {}),
+				Config{OnStart: func([]string) { close(started) }})
+		}()
+		<-started
+		Stop()
+		if err := <-ret; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Goroutines may take a moment to exit after the watcher is closed.
+	var n int
+	for i := 0; i < 50; i++ {
+		if n = runtime.NumGoroutine(); n <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	buf := make([]byte, 1<<16)
+	t.Errorf("%d goroutines before, %d after:\n%s", before, n, buf[:runtime.Stack(buf, true)])
+}
+
+func TestTriggerOp(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w      = newFakeWatcher()
+		called = make(chan struct{}, 2)
+		file   = filepath.Join(tmp, "file")
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), Dir(tmp, func() { called <- struct{}{} }),
+			Config{TriggerOp: OpChmod})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w.events <- WatchEvent{Name: file, Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: file, Op: OpChmod}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	if len(called) > 0 {
+		t.Error("callback run for wrong op")
+	}
+}
+
+func TestSuppressCallbacksAfterRestart(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		l         = &testLogger{}
+		w         = newFakeWatcher()
+		called    = make(chan struct{}, 2)
+		restarted = make(chan struct{}, 2)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), Dir(tmp, func() { called <- struct{}{} }),
+			WithRestart(func(Reason) { restarted <- struct{}{} }),
+			Config{SuppressCallbacksAfterRestart: time.Minute})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "file"), Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: ignoring change to")
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+	if len(called) > 0 {
+		t.Error("callback run after the binary changed")
+	}
+}
+
+func TestStartupGrace(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		l      = &testLogger{}
+		w      = newFakeWatcher()
+		called = make(chan struct{}, 2)
+		file   = filepath.Join(tmp, "file")
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), Dir(tmp, func() { called <- struct{}{} }),
+			Config{StartupGrace: 200 * time.Millisecond})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w.events <- WatchEvent{Name: file, Op: OpChmod} // Wrong op, not logged.
+	w.events <- WatchEvent{Name: file, Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: ignoring change")
+	if len(called) > 0 {
+		t.Fatal("callback run during grace period")
+	}
+	var n int
+	for _, line := range l.lines() {
+		if strings.HasPrefix(line, "INFO reload: ignoring change") {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("logged %d ignored changes; have:\n%s", n, strings.Join(l.lines(), "\n"))
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	w.events <- WatchEvent{Name: file, Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run after grace period")
+	}
+}
+
+// The default watcher has a grace period without setting it.
+func TestStartupGraceDefault(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l := &testLogger{}
+	go func() {
+		if err := Do(nil, WithLogger(l), Dir(tmp, func() {})); err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	if err := ioutil.WriteFile(filepath.Join(tmp, "file"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l.wait(t, "INFO reload: ignoring change")
+}
+
+func TestRewatchAfterFailedExec(t *testing.T) {
+	oldExec := RestartExec
+	defer func() { RestartExec = oldExec }()
+
+	var (
+		watchers  = make(chan *fakeWatcher, 3)
+		w         *fakeWatcher
+		restarted = make(chan struct{}, 2)
+	)
+	newWatcher := optionFunc(func(r *reloader) {
+		r.newWatcher = func() (Watcher, error) {
+			w := newFakeWatcher()
+			watchers <- w
+			return w, nil
+		}
+	})
+	RestartExec = func() {
+		// Returning is like a failed ExecErr().
+		if !w.Closed() {
+			t.Error("watcher not closed before restart")
+		}
+		restarted <- struct{}{}
+	}
+
+	go func() {
+		err := Do(log.Printf, newWatcher, Config{StartupGrace: -1})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w = <-watchers
+	w.events <- WatchEvent{Name: "/ignored", Op: OpCreate | OpWrite}
+	_, launch := binPaths()
+	added := w.Added()
+	for i := 0; i < 2; i++ {
+		w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+		select {
+		case <-restarted:
+		case <-time.After(time.Second):
+			t.Fatalf("not restarted (%d)", i)
+		}
+		w = <-watchers
+		if got := w.Added(); !reflect.DeepEqual(got, added) {
+			t.Errorf("\ngot:  %q\nwant: %q", got, added)
+		}
+	}
+}
+
+// A watcher from WithWatcher() can't be recreated, so it's not closed if the
+// restart function returns.
+func TestRestartKeepsWatcher(t *testing.T) {
+	var (
+		w         = newFakeWatcher()
+		restarted = make(chan struct{}, 2)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), WithRestart(func(Reason) { restarted <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w.events <- WatchEvent{Name: "/ignored", Op: OpCreate | OpWrite}
+	_, launch := binPaths()
+	added := w.Added()
+	for i := 0; i < 2; i++ {
+		w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+		select {
+		case <-restarted:
+		case <-time.After(time.Second):
+			t.Fatalf("not restarted (%d)", i)
+		}
+		if w.Closed() {
+			t.Fatal("watcher closed")
+		}
+	}
+	w.events <- WatchEvent{Name: "/ignored", Op: OpCreate | OpWrite}
+	if got := w.Added(); !reflect.DeepEqual(got, added) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, added)
+	}
+}
+
+func TestMultipleCallbacks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w      = newFakeWatcher()
+		called = make(chan string, 3)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Dir(tmp, func() { called <- "first" }),
+			Dir(tmp, func() { called <- "second" }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "file"), Op: OpCreate | OpWrite}
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-called:
+			if got != want {
+				t.Errorf("got %q; want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s callback not run", want)
+		}
+	}
+
+	var n int
+	for _, a := range w.Added() {
+		if a == tmp {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("%q added %d times", tmp, n)
+	}
+}
+
+func TestDirFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, "config")
+	if err := ioutil.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		w      = newFakeWatcher()
+		called = make(chan struct{}, 3)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), Dir(file, func() { called <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "other"), Op: OpCreate | OpWrite}
+	// Renamed over the file.
+	w.events <- WatchEvent{Name: file, Op: OpCreate}
+	w.events <- WatchEvent{Name: file, Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	select {
+	case <-called:
+		t.Error("callback run more than once, or for other file")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if got, want := w.Added(), tmp; !contains(got, want) {
+		t.Errorf("%q not in %q", want, got)
+	}
+}
+
+func TestResolveBinary(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(tmp, "app")
+	if err := ioutil.WriteFile(app, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldSelf, oldLaunch := binSelf, binLaunch
+	defer func() { binSelf, binLaunch = oldSelf, oldLaunch }()
+
+	err = Do(log.Printf, WithWatcher(newFakeWatcher()),
+		Config{ResolveBinary: func() (string, error) { return "", errors.New("oops") }})
+	if !errorContains(err, "cannot resolve binary: oops") {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	var (
+		w         = newFakeWatcher()
+		restarted = make(chan Reason, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), WithRestart(func(r Reason) { restarted <- r }),
+			Config{ResolveBinary: func() (string, error) { return app, nil }})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w.events <- WatchEvent{Name: app, Op: OpCreate | OpWrite}
+	select {
+	case r := <-restarted:
+		if r.Path != app {
+			t.Errorf("wrong path: %q", r.Path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("not restarted")
+	}
+	if got := w.Added(); len(got) == 0 || got[0] != tmp {
+		t.Errorf("wrong dirs: %q", got)
+	}
+	if bin, launch := binPaths(); bin != app || launch != app {
+		t.Errorf("binSelf = %q, binLaunch = %q", bin, launch)
+	}
+}
+
+func TestDirOverlapsBinary(t *testing.T) {
+	bin, err := self()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bin, err = filepath.EvalSymlinks(bin); err != nil {
+		t.Fatal(err)
+	}
+	binDir := filepath.Dir(bin)
+
+	var (
+		w      = newFakeWatcher()
+		called = make(chan string, 2)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Dir(binDir, func() { called <- "a" }),
+			Dir(binDir, func() { called <- "b" }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w.events <- WatchEvent{Name: filepath.Join(binDir, "other"), Op: OpCreate | OpWrite}
+	for _, want := range []string{"a", "b"} {
+		select {
+		case got := <-called:
+			if got != want {
+				t.Errorf("got %q; want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s not called", want)
+		}
+	}
+	if got, want := w.Added(), []string{binDir}; !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestIgnoreBinary(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w         = newFakeWatcher()
+		called    = make(chan struct{}, 1)
+		restarted = make(chan struct{}, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), Config{IgnoreBinary: true},
+			Dir(tmp, func() { called <- struct{}{} }),
+			WithRestart(func(Reason) { restarted <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	launch, err := self()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "file"), Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	select {
+	case <-restarted:
+		t.Error("restarted")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if got, want := w.Added(), []string{tmp}; !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestSetRestart(t *testing.T) {
+	oldExec := RestartExec
+	defer SetRestart(oldExec)
+
+	var (
+		w         = newFakeWatcher()
+		restarted = make(chan int, 10)
+		started   = make(chan struct{})
+	)
+	SetRestart(func() { restarted <- 0 })
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), Config{OnStart: func([]string) { close(started) }})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 5; i++ {
+			i := i
+			SetRestart(func() { restarted <- i })
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	_, launch := binPaths()
+	for i := 0; i < 3; i++ {
+		w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+		select {
+		case <-restarted:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("not restarted (%d)", i)
+		}
+	}
+	<-done
+}
+
+func TestSkipUnchangedBinary(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(tmp, "app")
+	if err := ioutil.WriteFile(app, []byte("v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldSelf, oldLaunch := binSelf, binLaunch
+	defer func() { binSelf, binLaunch = oldSelf, oldLaunch }()
+
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		restarted = make(chan struct{}, 2)
+		changed   = make(chan string, 2)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(Reason) { restarted <- struct{}{} }),
+			Config{
+				SkipUnchangedBinary: true,
+				ResolveBinary:       func() (string, error) { return app, nil },
+				OnChange:            func(path string, _ Op) { changed <- path },
+			})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	// Touched, or rewritten with the same content.
+	if err := ioutil.WriteFile(app, []byte("v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	w.events <- WatchEvent{Name: app, Op: OpWrite}
+	l.wait(t, "INFO reload: binary unchanged, skipping restart")
+	select {
+	case <-restarted:
+		t.Fatal("restarted for an identical binary")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if len(changed) > 0 {
+		t.Errorf("OnChange called for an identical binary: %q", <-changed)
+	}
+
+	if err := ioutil.WriteFile(app, []byte("v2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	w.events <- WatchEvent{Name: app, Op: OpWrite}
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+	if c := <-changed; c != app {
+		t.Errorf("OnChange called for %q", c)
+	}
+}
+
+func TestSettleWindow(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(tmp, "app")
+	if err := ioutil.WriteFile(app, []byte("v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldSelf, oldLaunch := binSelf, binLaunch
+	defer func() { binSelf, binLaunch = oldSelf, oldLaunch }()
+
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		restarted = make(chan struct{}, 2)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(Reason) { restarted <- struct{}{} }),
+			Config{SettleWindow: 300 * time.Millisecond, ResolveBinary: func() (string, error) { return app, nil }})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	notRestarted := func(d time.Duration) {
+		t.Helper()
+		select {
+		case <-restarted:
+			t.Fatal("restarted before the binary settled")
+		case <-time.After(d):
+		}
+	}
+
+	// Every event resets the timer.
+	w.events <- WatchEvent{Name: app, Op: OpWrite}
+	notRestarted(200 * time.Millisecond)
+	w.events <- WatchEvent{Name: app, Op: OpWrite}
+	notRestarted(200 * time.Millisecond)
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+	notRestarted(400 * time.Millisecond)
+
+	// The binary was removed before the timer fired.
+	w.events <- WatchEvent{Name: app, Op: OpWrite}
+	if err := os.Remove(app); err != nil {
+		t.Fatal(err)
+	}
+	l.wait(t, "ERROR reload error: not restarting")
+	notRestarted(100 * time.Millisecond)
+}
+
+func TestCheckModTime(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(tmp, "app")
+	if err := ioutil.WriteFile(app, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldSelf, oldLaunch := binSelf, binLaunch
+	defer func() { binSelf, binLaunch = oldSelf, oldLaunch }()
+
+	var (
+		w         = newFakeWatcher()
+		restarted = make(chan struct{}, 2)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), WithRestart(func(Reason) { restarted <- struct{}{} }),
+			Config{CheckModTime: true, ResolveBinary: func() (string, error) { return app, nil }})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	// Not modified.
+	w.events <- WatchEvent{Name: app, Op: OpCreate | OpWrite}
+	select {
+	case <-restarted:
+		t.Fatal("restarted without a newer modification time")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(app, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		w.events <- WatchEvent{Name: app, Op: OpCreate | OpWrite}
+		time.Sleep(200 * time.Millisecond)
+	}
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+	select {
+	case <-restarted:
+		t.Error("restarted twice for the same modification time")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestDirAndDirFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w      = newFakeWatcher()
+		called = make(chan string, 4)
+		files  = make(chan []string, 2)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Dir(tmp, func() { called <- "dir" }),
+			DirFiles(tmp, func(f []string) { files <- f }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	a, b := filepath.Join(tmp, "a"), filepath.Join(tmp, "b")
+	w.events <- WatchEvent{Name: a, Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: b, Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("Dir callback not run")
+	}
+	select {
+	case f := <-files:
+		if want := []string{a, b}; !reflect.DeepEqual(f, want) {
+			t.Errorf("\ngot:  %q\nwant: %q", f, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("DirFiles callback not run")
+	}
+	var n int
+	for _, d := range w.Added() {
+		if d == tmp {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("%q added %d times", tmp, n)
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		sep       byte
+		want      bool
+	}{
+		{"/srv/tpl", "/srv/tpl", '/', true},
+		{"/srv/tpl/a", "/srv/tpl", '/', true},
+		{"/srv/tpl-old/a", "/srv/tpl", '/', false},
+		{"/srv/tpl.bak", "/srv/tpl", '/', false},
+		{"/srv/tpl_backup/a", "/srv/tpl", '/', false},
+		{"/srv", "/", '/', true},
+		{`C:\srv\tpl\a`, `C:\srv\tpl`, '\\', true},
+		{`C:\srv\tpl-old\a`, `C:\srv\tpl`, '\\', false},
+		{`C:\srv`, `C:\`, '\\', true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := hasPathPrefix(tt.path, tt.dir, tt.sep); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirSibling(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	tpl := filepath.Join(tmp, "tpl")
+	if err := os.Mkdir(tpl, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		w      = newFakeWatcher()
+		called = make(chan struct{}, 2)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), Dir(tpl, func() { called <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "tpl-old", "a"), Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: tpl + ".bak", Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "tpl_backup", "a"), Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+		t.Error("callback run for sibling directory")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	w.events <- WatchEvent{Name: filepath.Join(tpl, "a"), Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Error("callback not run for file in directory")
+	}
+}
+
+func TestCanRestart(t *testing.T) {
+	oldInterval := canRestartInterval
+	defer func() { canRestartInterval = oldInterval }()
+	canRestartInterval = 50 * time.Millisecond
+
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		restarted = make(chan struct{}, 2)
+		safe      = make(chan bool, 1)
+		calls     int32
+	)
+	safe <- false
+	canRestart := func() bool {
+		atomic.AddInt32(&calls, 1)
+		s := <-safe
+		safe <- s
+		return s
+	}
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(Reason) { restarted <- struct{}{} }),
+			Config{CanRestart: canRestart})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: not restarting yet")
+	select {
+	case <-restarted:
+		t.Fatal("restarted while CanRestart returned false")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if n := atomic.LoadInt32(&calls); n < 2 {
+		t.Errorf("CanRestart called %d times; want it to be retried", n)
+	}
+
+	<-safe
+	safe <- true
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted once CanRestart returned true")
+	}
+}
+
+// New changes while the restart is postponed don't push back the next try.
+func TestCanRestartSteadyChanges(t *testing.T) {
+	oldInterval := canRestartInterval
+	defer func() { canRestartInterval = oldInterval }()
+	canRestartInterval = 250 * time.Millisecond
+
+	var (
+		w     = newFakeWatcher()
+		l     = &testLogger{}
+		calls int32
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(Reason) {}),
+			Config{
+				SettleWindow: 10 * time.Millisecond,
+				CanRestart:   func() bool { atomic.AddInt32(&calls, 1); return false },
+			})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	const changes = 10
+	for i := 0; i < changes; i++ {
+		w.events <- WatchEvent{Name: launch, Op: OpWrite}
+		time.Sleep(100 * time.Millisecond)
+	}
+	// Every change is checked once, and the retries every 250ms on top of that.
+	if n := atomic.LoadInt32(&calls); n < changes+2 {
+		t.Errorf("CanRestart called %d times for %d changes; want it to be retried too", n, changes)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w         = newFakeWatcher()
+		started   = make(chan struct{})
+		changes   = make(chan string, 10)
+		restarted = make(chan struct{}, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), WithRestart(func(Reason) { restarted <- struct{}{} }),
+			Config{
+				TriggerOp: OpWrite,
+				OnStart:   func([]string) { close(started) },
+				OnChange:  func(path string, op Op) { changes <- op.String() + " " + filepath.Base(path) },
+			},
+			Dir(tmp, func() {}),
+			Glob(filepath.Join(tmp, "*.tmpl"), func() {}))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	<-started
+
+	_, launch := binPaths()
+	for _, e := range []WatchEvent{
+		{Name: filepath.Join(tmp, "a.go"), Op: OpWrite},
+		{Name: filepath.Join(tmp, "a.go"), Op: OpWrite},   // Same burst, called once.
+		{Name: filepath.Join(tmp, "a.tmpl"), Op: OpWrite}, // Matches both, but called once.
+		{Name: filepath.Join(tmp, "b.go"), Op: OpChmod},   // Wrong op.
+		{Name: filepath.Join(filepath.Dir(tmp), "other"), Op: OpWrite},
+		{Name: launch, Op: OpWrite},
+		{Name: launch, Op: OpWrite},
+	} {
+		w.events <- e
+	}
+	if len(changes) > 0 {
+		t.Errorf("called before the writes settled: %q", <-changes)
+	}
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+
+	close(changes)
+	var got []string
+	for c := range changes {
+		got = append(got, c)
+	}
+	want := []string{"WRITE a.go", "WRITE a.tmpl", "WRITE " + filepath.Base(launch)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestDirBurst(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	other, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+
+	var (
+		w      = newFakeWatcher()
+		called = make(chan string, 20)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Dir(tmp, func() { called <- "first" }),
+			Dir(other, func() { called <- "other" }),
+			Dir(tmp, func() { called <- "second" }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	for i := 0; i < 10; i++ {
+		w.events <- WatchEvent{Name: filepath.Join(tmp, strconv.Itoa(i)), Op: OpCreate | OpWrite}
+	}
+	w.events <- WatchEvent{Name: filepath.Join(other, "x"), Op: OpCreate | OpWrite}
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case c := <-called:
+			got = append(got, c)
+		case <-time.After(time.Second):
+			t.Fatalf("callbacks not run: %q", got)
+		}
+	}
+	select {
+	case c := <-called:
+		t.Errorf("callback %q run more than once", c)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The callbacks for one directory are run in order; other directories
+	// have their own timer.
+	var same []string
+	for _, c := range got {
+		if c != "other" {
+			same = append(same, c)
+		}
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(same, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestDirChanges(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w       = newFakeWatcher()
+		changes = make(chan []Change, 2)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), DirChanges(tmp, func(c []Change) { changes <- c }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	a, b := filepath.Join(tmp, "a"), filepath.Join(tmp, "b")
+	w.events <- WatchEvent{Name: a, Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: b, Op: OpCreate | OpWrite}
+	w.events <- WatchEvent{Name: a, Op: OpWrite}
+
+	var got []Change
+	select {
+	case got = <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	if len(got) != 2 || got[0].Time.IsZero() || got[1].Time.IsZero() || got[0].Time.Before(got[1].Time) {
+		t.Fatalf("wrong changes: %v", got)
+	}
+	for i := range got {
+		got[i].Time = time.Time{}
+	}
+	want := []Change{{Path: a, Op: OpWrite}, {Path: b, Op: OpCreate | OpWrite}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestBusyCheck(t *testing.T) {
+	for _, maxHold := range []time.Duration{0, 200 * time.Millisecond} {
+		t.Run(maxHold.String(), func(t *testing.T) {
+			var (
+				w         = newFakeWatcher()
+				l         = &testLogger{}
+				restarted = make(chan struct{}, 3)
+				busy      = int32(1)
+			)
+			go func() {
+				err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(Reason) { restarted <- struct{}{} }),
+					WithBusyCheck(func() bool { return atomic.LoadInt32(&busy) == 1 }, 20*time.Millisecond, maxHold))
+				if err != nil {
+					panic(err)
+				}
+			}()
+			defer Stop()
+			l.wait(t, "INFO restarting")
+
+			_, launch := binPaths()
+			w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+			l.wait(t, "INFO reload: not restarting yet, as the busy check returned true")
+			if !Stats().RestartPending {
+				t.Error("RestartPending not set")
+			}
+			if ok, p := Pending(); !ok || p.Policy != HeldByBusy || p.Reason.Path != launch {
+				t.Errorf("wrong Pending(): %t %#v", ok, p)
+			}
+			// Doesn't stack.
+			w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+
+			if maxHold > 0 {
+				l.wait(t, "INFO reload: restarting anyway after waiting 200ms")
+			} else {
+				select {
+				case <-restarted:
+					t.Fatal("restarted while busy")
+				case <-time.After(300 * time.Millisecond):
+				}
+				atomic.StoreInt32(&busy, 0)
+			}
+
+			select {
+			case <-restarted:
+			case <-time.After(time.Second):
+				t.Fatal("not restarted")
+			}
+			select {
+			case <-restarted:
+				t.Error("restarted twice")
+			case <-time.After(200 * time.Millisecond):
+			}
+			if Stats().RestartPending {
+				t.Error("RestartPending still set")
+			}
+			if ok, _ := Pending(); ok {
+				t.Error("Pending() still set")
+			}
+		})
+	}
+}
+
+func TestAsyncCallbacks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	other, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+
+	var (
+		w       = newFakeWatcher()
+		l       = &testLogger{}
+		release = make(chan struct{})
+		called  = make(chan string, 2)
+		running int32
+	)
+	cb := func(name string) func() {
+		return func() {
+			if atomic.AddInt32(&running, 1) != 1 {
+				t.Error("callbacks run at the same time")
+			}
+			called <- name
+			<-release
+			atomic.AddInt32(&running, -1)
+		}
+	}
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), Config{AsyncCallbacks: true},
+			Dir(tmp, cb("tmp")), Dir(other, cb("other")))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "x"), Op: OpCreate | OpWrite}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+
+	// Events are still handled while it's running, but the other callback
+	// waits its turn.
+	for i := 0; i < 3; i++ {
+		select {
+		case w.events <- WatchEvent{Name: filepath.Join(other, strconv.Itoa(i)), Op: OpCreate | OpWrite}:
+		case <-time.After(time.Second):
+			t.Fatal("event loop blocked by callback")
+		}
+	}
+	select {
+	case c := <-called:
+		t.Fatalf("callback %q run while another is running", c)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	release <- struct{}{}
+	select {
+	case c := <-called:
+		if c != "other" {
+			t.Errorf("wrong callback: %q", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	release <- struct{}{}
+}
+
+func TestWaitForRestart(t *testing.T) {
+	defer SetRestart(RestartExec)
+	SetRestart(func() {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := WaitForRestart(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	var (
+		w    = newFakeWatcher()
+		l    = &testLogger{}
+		errs = make(chan error, 2)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			errs <- WaitForRestart(ctx)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("WaitForRestart: %v", err)
+		}
+	}
+}
+
+func TestCallbacksBeforeRestart(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, async := range []bool{false, true} {
+		t.Run(fmt.Sprintf("async=%t", async), func(t *testing.T) {
+			var (
+				w     = newFakeWatcher()
+				l     = &testLogger{}
+				mu    sync.Mutex
+				order []string
+				add   = func(s string) {
+					mu.Lock()
+					defer mu.Unlock()
+					order = append(order, s)
+				}
+				restarted = make(chan struct{}, 1)
+			)
+			go func() {
+				err := Do(nil, WithLogger(l), WithWatcher(w),
+					Config{SettleWindow: 20 * time.Millisecond, AsyncCallbacks: async},
+					Dir(tmp, func() {
+						time.Sleep(50 * time.Millisecond)
+						add("callback")
+					}),
+					WithRestart(func(Reason) {
+						add("restart")
+						restarted <- struct{}{}
+					}))
+				if err != nil {
+					panic(err)
+				}
+			}()
+			defer Stop()
+			l.wait(t, "INFO restarting")
+
+			_, launch := binPaths()
+			w.events <- WatchEvent{Name: filepath.Join(tmp, "x"), Op: OpCreate | OpWrite}
+			w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+			select {
+			case <-restarted:
+			case <-time.After(time.Second):
+				t.Fatal("not restarted")
+			}
+			l.wait(t, "INFO reload: running callbacks for "+relpath(tmp)+" before restarting")
+
+			// The callback isn't run again once the directory is quiet.
+			time.Sleep(200 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			if want := []string{"callback", "restart"}; !reflect.DeepEqual(order, want) {
+				t.Errorf("\nout:  %q\nwant: %q", order, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+//go:build !windows
+// +build !windows
+
+package reload
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignal(t *testing.T) {
+	restarted := make(chan Reason, 1)
+	go func() {
+		err := Do(log.Printf, WithSignal(syscall.SIGUSR1),
+			WithRestart(func(r Reason) { restarted <- r }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-restarted:
+		if r.Kind != Signal || r.Signal != syscall.SIGUSR1 {
+			t.Errorf("wrong reason: %#v", r)
+		}
+		if r.String() != "received signal user defined signal 1" {
+			t.Errorf("wrong reason string: %q", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("not restarted after signal")
+	}
+}
+
+func TestApprovalSignal(t *testing.T) {
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		restarted = make(chan Reason, 1)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithApproval(syscall.SIGUSR2),
+			WithRestart(func(r Reason) { restarted <- r }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: new binary detected, awaiting approval")
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-restarted:
+		if r.Kind != BinaryChanged {
+			t.Errorf("wrong reason: %#v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("not restarted after signal")
+	}
+	l.wait(t, "INFO reload: restart approved by signal user defined signal 2")
+}
+
+func TestConfigRestartError(t *testing.T) {
+	calls := make(chan struct{}, 2)
+	go func() {
+		err := Do(log.Printf, WithSignal(syscall.SIGUSR2), Config{Restart: func() error {
+			calls <- struct{}{}
+			return errors.New("oops")
+		}})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	// Should keep watching after an error.
+	for i := 0; i < 2; i++ {
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-calls:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("restart %d not called", i)
+		}
+	}
+}
+
+func TestSymlinkedBinary(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		t.Fatal(err)
+	}
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(tmp, "shim")
+	if err := os.Symlink(exe, link); err != nil {
+		t.Fatal(err)
+	}
+
+	oldArgs, oldLaunch := os.Args[0], binLaunch
+	defer func() { os.Args[0], binLaunch = oldArgs, oldLaunch }()
+	os.Args[0] = link
+
+	var (
+		w         = newFakeWatcher()
+		restarted = make(chan Reason, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), WithRestart(func(r Reason) { restarted <- r }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	// Changes to the real binary trigger a restart.
+	w.events <- WatchEvent{Name: exe, Op: OpWrite | OpCreate}
+	select {
+	case r := <-restarted:
+		if r.Path != exe {
+			t.Errorf("wrong path: %q", r.Path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("not restarted")
+	}
+
+	// Both are added again after the restart returns.
+	want := []string{filepath.Dir(exe), tmp}
+	if got := w.Added(); len(got) < len(want) || !reflect.DeepEqual(got[:len(want)], want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	if bin, launch := binPaths(); bin != exe || launch != link {
+		t.Errorf("binSelf = %q, binLaunch = %q", bin, launch)
+	}
+}
+
+func TestDirNotRegular(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	fifo := filepath.Join(tmp, "fifo")
+	if err := syscall.Mkfifo(fifo, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Do(log.Printf, WithWatcher(newFakeWatcher()), Dir(fifo, func() {}))
+	if !errorContains(err, "not a directory or regular file") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestForceSignal(t *testing.T) {
+	// It's noon in this zone, outside the window.
+	loc := time.FixedZone("test", 12*3600-int(time.Now().Unix()%86400))
+	var (
+		l         = &testLogger{}
+		restarted = make(chan Reason, 2)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(newFakeWatcher()), WithRestartWindow(loc, "14:00-15:00"),
+			WithSignal(syscall.SIGUSR1), WithForceSignal(syscall.SIGUSR2),
+			WithRestart(func(r Reason) { restarted <- r }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	l.wait(t, "INFO reload: not restarting yet, as it's outside the restart window")
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-restarted:
+		if r.Kind != Signal || r.Signal != syscall.SIGUSR2 || !r.Force {
+			t.Errorf("wrong reason: %#v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("not restarted after signal")
+	}
+}
@@ -0,0 +1,24 @@
+package reloadprom_test
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/teamwork/reload"
+	"github.com/teamwork/reload/reloadprom"
+)
+
+func Example() {
+	prometheus.MustRegister(reloadprom.NewCollector())
+	http.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		err := reload.Do(log.Printf)
+		if err != nil {
+			panic(err)
+		}
+	}()
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
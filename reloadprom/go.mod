@@ -0,0 +1,10 @@
+module github.com/teamwork/reload/reloadprom
+
+go 1.13
+
+require (
+	github.com/prometheus/client_golang v1.11.1
+	github.com/teamwork/reload v0.0.0-00010101000000-000000000000
+)
+
+replace github.com/teamwork/reload => ../
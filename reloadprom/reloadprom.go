@@ -0,0 +1,73 @@
+// Package reloadprom exports the counters from reload.Stats() as Prometheus
+// metrics.
+//
+// This is a separate module so that the reload package doesn't depend on the
+// Prometheus client:
+//
+//    prometheus.MustRegister(reloadprom.NewCollector())
+//    http.Handle("/metrics", promhttp.Handler())
+package reloadprom // import "github.com/teamwork/reload/reloadprom"
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/teamwork/reload"
+)
+
+// Collector is a prometheus.Collector for reload's metrics.
+type Collector struct {
+	restarts      *prometheus.Desc
+	lastRestart   *prometheus.Desc
+	dirEvents     *prometheus.Desc
+	dirCallbacks  *prometheus.Desc
+	watcherErrors *prometheus.Desc
+	events        *prometheus.Desc
+}
+
+// NewCollector creates a new Collector.
+func NewCollector() *Collector {
+	return &Collector{
+		restarts: prometheus.NewDesc("reload_restarts_total",
+			"Number of restarts, including those in previous processes.", nil, nil),
+		lastRestart: prometheus.NewDesc("reload_last_restart_timestamp_seconds",
+			"When the last restart in this process was started; 0 if there wasn't one yet.", nil, nil),
+		dirEvents: prometheus.NewDesc("reload_dir_events_total",
+			"Number of filesystem events for a watched directory.", []string{"dir"}, nil),
+		dirCallbacks: prometheus.NewDesc("reload_dir_callbacks_total",
+			"Number of callback calls for a watched directory.", []string{"dir"}, nil),
+		watcherErrors: prometheus.NewDesc("reload_watcher_errors_total",
+			"Number of errors from the watcher.", nil, nil),
+		events: prometheus.NewDesc("reload_events_total",
+			"Number of filesystem events.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.restarts
+	ch <- c.lastRestart
+	ch <- c.dirEvents
+	ch <- c.dirCallbacks
+	ch <- c.watcherErrors
+	ch <- c.events
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := reload.Stats()
+
+	var last float64
+	if !s.LastRestart.IsZero() {
+		last = float64(s.LastRestart.UnixNano()) / 1e9
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.restarts, prometheus.CounterValue, float64(s.Restarts))
+	ch <- prometheus.MustNewConstMetric(c.lastRestart, prometheus.GaugeValue, last)
+	for dir, n := range s.DirEvents {
+		ch <- prometheus.MustNewConstMetric(c.dirEvents, prometheus.CounterValue, float64(n), dir)
+	}
+	for dir, n := range s.DirCallbacks {
+		ch <- prometheus.MustNewConstMetric(c.dirCallbacks, prometheus.CounterValue, float64(n), dir)
+	}
+	ch <- prometheus.MustNewConstMetric(c.watcherErrors, prometheus.CounterValue, float64(s.WatcherErrors))
+	ch <- prometheus.MustNewConstMetric(c.events, prometheus.CounterValue, float64(s.EventsSeen))
+}
@@ -0,0 +1,24 @@
+package reloadprom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	want := `
+		# HELP reload_restarts_total Number of restarts, including those in previous processes.
+		# TYPE reload_restarts_total counter
+		reload_restarts_total 0
+		# HELP reload_watcher_errors_total Number of errors from the watcher.
+		# TYPE reload_watcher_errors_total counter
+		reload_watcher_errors_total 0
+	`
+	err := testutil.CollectAndCompare(NewCollector(), strings.NewReader(want),
+		"reload_restarts_total", "reload_watcher_errors_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,50 @@
+package reloadtest_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/teamwork/reload"
+	"github.com/teamwork/reload/reloadtest"
+)
+
+func Example() {
+	// The directory needs to exist, but nothing is written to it.
+	tpl := os.TempDir()
+
+	var (
+		w        = reloadtest.NewWatcher()
+		rs       reloadtest.Restarts
+		reloaded = make(chan struct{}, 1)
+	)
+	go func() {
+		err := reload.Do(func(string, ...interface{}) {},
+			reload.WithWatcher(w),
+			reload.WithRestart(rs.Restart),
+			reload.Dir(tpl, func() { reloaded <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer reload.Stop()
+
+	// Goes through the same filtering and dispatch as a real change.
+	w.TriggerChange(filepath.Join(tpl, "index.html"))
+	select {
+	case <-reloaded:
+		fmt.Println("templates reloaded")
+	case <-time.After(time.Second):
+		fmt.Println("templates not reloaded")
+	}
+
+	w.TriggerBinaryChange()
+	if r, ok := rs.Wait(time.Second); ok {
+		fmt.Println(r.Kind)
+	}
+
+	// Output:
+	// templates reloaded
+	// binary changed
+}
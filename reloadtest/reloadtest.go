@@ -0,0 +1,169 @@
+// Package reloadtest provides helpers to test code that uses reload.
+//
+// Use Watcher to send synthetic changes to reload.Do(), and Restarts to record
+// restarts instead of replacing the process:
+//
+//    w := reloadtest.NewWatcher()
+//    var rs reloadtest.Restarts
+//    go reload.Do(t.Logf, reload.WithWatcher(w), reload.WithRestart(rs.Restart),
+//        reload.Dir("tpl", reloadTpl))
+//
+//    w.TriggerChange("tpl/index.html")
+//    w.TriggerBinaryChange()
+//    if _, ok := rs.Wait(time.Second); !ok {
+//        t.Fatal("not restarted")
+//    }
+package reloadtest // import "github.com/teamwork/reload/reloadtest"
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/teamwork/reload"
+)
+
+var _ reload.Watcher = &Watcher{}
+
+// Watcher is a reload.Watcher which only sends events from TriggerChange().
+type Watcher struct {
+	events chan reload.WatchEvent
+	errors chan error
+
+	mu     sync.Mutex
+	added  []string
+	closed bool
+}
+
+// NewWatcher creates a new fake watcher.
+func NewWatcher() *Watcher {
+	return &Watcher{
+		events: make(chan reload.WatchEvent),
+		errors: make(chan error),
+	}
+}
+
+// Events implements reload.Watcher.
+func (w *Watcher) Events() <-chan reload.WatchEvent { return w.events }
+
+// Errors implements reload.Watcher.
+func (w *Watcher) Errors() <-chan error { return w.errors }
+
+// Add implements reload.Watcher.
+func (w *Watcher) Add(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.added = append(w.added, path)
+	return nil
+}
+
+// Close implements reload.Watcher.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+// Added gets all paths passed to Add().
+func (w *Watcher) Added() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.added...)
+}
+
+// Closed reports if Close() was called.
+func (w *Watcher) Closed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+// TriggerChange sends a change event for path, as if the file was written. A
+// relative path is made absolute first.
+//
+// This blocks until reload.Do() has received the event.
+func (w *Watcher) TriggerChange(path string) {
+	w.TriggerOp(path, reload.OpCreate|reload.OpWrite)
+}
+
+// TriggerOp sends an event with a specific operation for path. A relative path
+// is made absolute first.
+//
+// This blocks until reload.Do() has received the event.
+func (w *Watcher) TriggerOp(path string, op reload.Op) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	w.events <- reload.WatchEvent{Name: path, Op: op}
+}
+
+// TriggerBinaryChange sends a change event for the current binary.
+func (w *Watcher) TriggerBinaryChange() {
+	bin := os.Args[0]
+	if !filepath.IsAbs(bin) {
+		var err error
+		bin, err = os.Executable()
+		if err != nil {
+			panic(err)
+		}
+	}
+	w.TriggerChange(bin)
+}
+
+// TriggerError sends an error.
+//
+// This blocks until reload.Do() has received the error.
+func (w *Watcher) TriggerError(err error) { w.errors <- err }
+
+// Restarts records restarts, instead of replacing the process. Use the Restart
+// method with reload.WithRestart().
+//
+// The zero value is ready to use.
+type Restarts struct {
+	mu      sync.Mutex
+	reasons []reload.Reason
+	ch      chan reload.Reason
+}
+
+func (r *Restarts) init() {
+	if r.ch == nil {
+		r.ch = make(chan reload.Reason, 64)
+	}
+}
+
+// Restart records the restart; this is a reload.RestartFunc.
+func (r *Restarts) Restart(reason reload.Reason) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.init()
+	r.reasons = append(r.reasons, reason)
+	select {
+	case r.ch <- reason:
+	default:
+	}
+}
+
+// All gets all recorded restarts.
+func (r *Restarts) All() []reload.Reason {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]reload.Reason{}, r.reasons...)
+}
+
+// Wait for the next restart, returning false if there wasn't any within the
+// timeout.
+func (r *Restarts) Wait(timeout time.Duration) (reload.Reason, bool) {
+	r.mu.Lock()
+	r.init()
+	ch := r.ch
+	r.mu.Unlock()
+
+	select {
+	case reason := <-ch:
+		return reason, true
+	case <-time.After(timeout):
+		return reload.Reason{}, false
+	}
+}
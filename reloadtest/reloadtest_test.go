@@ -0,0 +1,57 @@
+package reloadtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/teamwork/reload"
+)
+
+func TestTrigger(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reloadtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		w      = NewWatcher()
+		rs     Restarts
+		called = make(chan struct{}, 1)
+	)
+	go func() {
+		err := reload.Do(func(string, ...interface{}) {},
+			reload.WithWatcher(w),
+			reload.WithRestart(rs.Restart),
+			reload.Dir(tmp, func() { called <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer reload.Stop()
+
+	w.TriggerChange(filepath.Join(tmp, "file"))
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("callback not run")
+	}
+	if _, ok := rs.Wait(10 * time.Millisecond); ok {
+		t.Fatal("restarted on directory change")
+	}
+
+	w.TriggerBinaryChange()
+	r, ok := rs.Wait(time.Second)
+	if !ok {
+		t.Fatal("not restarted")
+	}
+	if r.Kind != reload.BinaryChanged {
+		t.Errorf("wrong reason: %s", r)
+	}
+	if len(rs.All()) != 1 {
+		t.Errorf("wrong number of restarts: %v", rs.All())
+	}
+}
@@ -0,0 +1,143 @@
+package reload
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// ReasonKind is the kind of event that triggered a restart.
+type ReasonKind int
+
+// Restart reasons.
+const (
+	BinaryChanged ReasonKind = iota + 1 // The binary changed.
+	Manual                              // Restart() was called.
+	Signal                              // A signal from WithSignal() was received.
+	Trigger                             // Something was written to the WatchTrigger() FIFO.
+)
+
+func (k ReasonKind) String() string {
+	switch k {
+	case BinaryChanged:
+		return "binary changed"
+	case Manual:
+		return "manual"
+	case Signal:
+		return "signal"
+	case Trigger:
+		return "trigger"
+	default:
+		return "unknown"
+	}
+}
+
+// Reason describes why a restart was triggered.
+type Reason struct {
+	Kind   ReasonKind
+	Path   string    // Path of the changed file, for BinaryChanged, or the FIFO for Trigger.
+	Op     Op        // Operation on Path, for BinaryChanged.
+	Signal os.Signal // Received signal, for Signal.
+	Force  bool      // Restart outside the WithRestartWindow() window.
+}
+
+func (r Reason) String() string {
+	switch r.Kind {
+	case BinaryChanged:
+		return "binary changed (" + r.Op.String() + " " + relpath(r.Path) + ")"
+	case Manual:
+		return "manual restart"
+	case Signal:
+		return "received signal " + r.Signal.String()
+	case Trigger:
+		return "written to " + relpath(r.Path)
+	default:
+		return r.Kind.String()
+	}
+}
+
+// RestartFunc restarts the process.
+type RestartFunc func(reason Reason)
+
+// WithRestart sets the function to restart the process, instead of calling
+// RestartExec. This can be used to log the reason or pick a restart strategy
+// based on it.
+func WithRestart(fn RestartFunc) Option {
+	return optionFunc(func(r *reloader) { r.restart = fn })
+}
+
+// WithBusyCheck postpones restarts while busy returns true, for example while
+// a long-running job is in progress. It's checked again every interval (every
+// second if 0) until it returns false, at which point the process restarts.
+//
+// If maxHold isn't 0 the process restarts anyway once it's been postponed for
+// that long. Changes while a restart is postponed don't cause extra restarts,
+// and Dir() callbacks are still run. Stats().RestartPending is true while a
+// restart is postponed.
+func WithBusyCheck(busy func() bool, interval, maxHold time.Duration) Option {
+	return optionFunc(func(r *reloader) {
+		r.busy, r.busyInterval, r.busyMaxHold = busy, interval, maxHold
+	})
+}
+
+// Manual restarts from Restart().
+var manual = make(chan Reason, 1)
+
+// Restart triggers a restart from the event loop in Do(), going through the
+// same steps as a binary change (such as WithPreRestartCommand). This is useful
+// as a Dir() callback.
+//
+// Unlike Exec() this returns immediately. It does nothing if Do() isn't
+// running.
+func Restart() {
+	select {
+	case manual <- Reason{Kind: Manual}:
+	default:
+	}
+}
+
+// Closed and replaced every time Do() restarts the process, for
+// WaitForRestart(). Guarded by restartMu.
+var restartWait = make(chan struct{})
+
+// WaitForRestart blocks until Do() restarts the process, and returns nil. It
+// returns ctx.Err() if ctx is done first.
+//
+// It returns right before the restart function is called (RestartExec, or the
+// one from WithRestart() or Config.Restart), so this is mostly useful in tests
+// with SetRestart() to synchronize on a restart without relying on the log:
+//
+//    reload.SetRestart(func() {})
+//    // Change the binary.
+//    err := reload.WaitForRestart(ctx)
+//
+// Restarts by calling Exec() directly aren't noticed.
+func WaitForRestart(ctx context.Context) error {
+	restartMu.Lock()
+	wait := restartWait
+	restartMu.Unlock()
+
+	select {
+	case <-wait:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wake up everyone in WaitForRestart().
+func notifyRestartWait() {
+	restartMu.Lock()
+	defer restartMu.Unlock()
+	close(restartWait)
+	restartWait = make(chan struct{})
+}
+
+// ForceRestart is like Restart(), but also restarts outside the window set with
+// WithRestartWindow().
+func ForceRestart() {
+	select {
+	case manual <- Reason{Kind: Manual, Force: true}:
+	default:
+	}
+}
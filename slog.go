@@ -0,0 +1,43 @@
+//go:build go1.21
+// +build go1.21
+
+package reload
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// WithSlog logs to a log/slog logger instead of the log function passed to
+// Do().
+//
+// These records have a stable message and attributes:
+//
+//    INFO  msg=watching     binary=<path> dirs=<paths>
+//    INFO  msg=restarting   path=<path> op=<op> reason=<kind>
+//    ERROR msg="watch error" err=<error>
+//    ERROR msg=error        err=<error>
+//
+// Anything else is logged at the appropriate level without attributes.
+func WithSlog(l *slog.Logger) Option {
+	return WithLogger(slogLogger{l})
+}
+
+// DoSlog is like Do(), but logs to a log/slog logger; see WithSlog().
+func DoSlog(l *slog.Logger, opts ...Option) error {
+	return Do(nil, append(opts, WithSlog(l))...)
+}
+
+type slogLogger struct{ l *slog.Logger }
+
+func (s slogLogger) Infof(format string, args ...interface{}) {
+	s.l.Info(fmt.Sprintf(format, args...))
+}
+func (s slogLogger) Errorf(format string, args ...interface{}) {
+	s.l.Error(fmt.Sprintf(format, args...))
+}
+func (s slogLogger) Debugf(format string, args ...interface{}) {
+	s.l.Debug(fmt.Sprintf(format, args...))
+}
+func (s slogLogger) info(msg string, kv ...interface{})  { s.l.Info(msg, kv...) }
+func (s slogLogger) error(msg string, kv ...interface{}) { s.l.Error(msg, kv...) }
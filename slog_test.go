@@ -0,0 +1,101 @@
+//go:build go1.21
+// +build go1.21
+
+package reload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestSlog(t *testing.T) {
+	bin, err := self()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldLogger := logger
+	defer func() { logger = oldLogger }()
+
+	var (
+		buf       syncBuffer
+		w         = newFakeWatcher()
+		restarted = make(chan struct{}, 1)
+	)
+	go func() {
+		err := DoSlog(slog.New(slog.NewJSONHandler(&buf, nil)),
+			WithWatcher(w),
+			WithRestart(func(Reason) { restarted <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	for start := time.Now(); !bytes.Contains([]byte(buf.String()), []byte(`"msg":"watching"`)); {
+		if time.Since(start) > time.Second {
+			t.Fatal("not started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	w.errors <- errors.New("oops")
+	w.events <- WatchEvent{Name: bin, Op: OpCreate | OpWrite}
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+
+	var records []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace([]byte(buf.String())), []byte("\n")) {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatalf("%s: %s", err, line)
+		}
+		delete(rec, "time")
+		records = append(records, rec)
+	}
+
+	want := []map[string]interface{}{
+		{"level": "INFO", "msg": "watching", "binary": bin, "dirs": []interface{}{}, "generation": float64(0)},
+		{"level": "ERROR", "msg": "watch error", "err": "oops"},
+		{"level": "INFO", "msg": "restarting", "path": bin, "op": "CREATE|WRITE", "reason": "binary changed"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("wrong records: %v", records)
+	}
+	for i := range want {
+		if !jsonEqual(records[i], want[i]) {
+			t.Errorf("record %d\nout:  %v\nwant: %v", i, records[i], want[i])
+		}
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
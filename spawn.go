@@ -0,0 +1,92 @@
+package reload
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// SpawnAndExit returns a restart function for RestartExec which starts the new
+// binary as a child process and then exits, rather than replacing the process
+// in-place. Unlike Exec() the new process gets a new PID, which some tools
+// (e.g. pidfile-based health checks) rely on to detect restarts.
+//
+// The new process inherits stdin, stdout, stderr, and the environment. This
+// process exits with code 0 once the new process has been running for the
+// grace period. If the new process exits before that then its exit status is
+// logged and this process keeps running.
+//
+// The OnExit() functions are run before the new process is started, like with
+// Exec(), so they can remove a pidfile that the new process then writes again.
+// They run again on the next restart if the new process couldn't be started
+// or exited during the grace period.
+//
+//    reload.RestartExec = reload.SpawnAndExit(time.Second)
+func SpawnAndExit(grace time.Duration) func() {
+	return func() {
+		beforeRestart(logger, false)
+		if err := spawn(grace); err != nil {
+			logError(logger, &RestartError{Err: fmt.Errorf("cannot restart, keeping the old process running: %w", err)})
+			return
+		}
+		if closeWatcher != nil {
+			closeWatcher()
+		}
+		os.Exit(0)
+	}
+}
+
+// stdin, stdout, and stderr for a new process, set by Do().
+var restartStdio [3]*os.File
+
+func stdio() (stdin, stdout, stderr *os.File) {
+	stdin, stdout, stderr = os.Stdin, os.Stdout, os.Stderr
+	if restartStdio[0] != nil {
+		stdin = restartStdio[0]
+	}
+	if restartStdio[1] != nil {
+		stdout = restartStdio[1]
+	}
+	if restartStdio[2] != nil {
+		stderr = restartStdio[2]
+	}
+	return stdin, stdout, stderr
+}
+
+func spawn(grace time.Duration) error {
+	_, bin := binPaths()
+	if bin == "" {
+		var err error
+		bin, err = self()
+		if err != nil {
+			return err
+		}
+	}
+
+	stdin, stdout, stderr := stdio()
+	p, err := os.StartProcess(bin, append([]string{bin}, execArgs()...), &os.ProcAttr{
+		Env:   execEnv(),
+		Files: []*os.File{stdin, stdout, stderr},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot start %q: %w", bin, err)
+	}
+
+	exited := make(chan string, 1)
+	go func() {
+		st, err := p.Wait()
+		if err != nil {
+			exited <- err.Error()
+			return
+		}
+		exited <- st.String()
+	}()
+
+	select {
+	case st := <-exited:
+		return fmt.Errorf("new process (pid %d) exited within %s: %s", p.Pid, grace, st)
+	case <-time.After(grace):
+		logger.Infof("reload: started new process with pid %d", p.Pid)
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package reload
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSpawnExited(t *testing.T) {
+	old := binLaunch
+	defer func() { binLaunch = old }()
+	binLaunch = "/bin/false"
+
+	err := spawn(2 * time.Second)
+	if !errorContains(err, "exited within 2s: exit status 1") {
+		t.Fatal(err)
+	}
+}
+
+func TestSpawnStdio(t *testing.T) {
+	out, err := ioutil.TempFile("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	oldBin, oldArgs, oldStdio := binLaunch, argFuncs, restartStdio
+	defer func() { binLaunch, argFuncs, restartStdio = oldBin, oldArgs, oldStdio }()
+	binLaunch = "/bin/sh"
+	argFuncs = []func([]string) []string{func([]string) []string { return []string{"-c", "echo hello"} }}
+	restartStdio = [3]*os.File{nil, out, nil}
+
+	err = spawn(2 * time.Second)
+	if !errorContains(err, "exit status 0") {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello\n" {
+		t.Errorf("wrong output: %q", got)
+	}
+}
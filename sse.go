@@ -0,0 +1,118 @@
+package reload
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LiveReloadJS reloads the page when a SSEHandler() mounted on
+// /debug/reload/events sends a reload event. After a restart it waits until
+// the server is back before reloading. Add it to HTML pages in development,
+// e.g. with template.HTML(reload.LiveReloadJS) in a html/template.
+const LiveReloadJS = `<script>
+(function() {
+	var restarting = false, es = new EventSource('/debug/reload/events');
+	es.addEventListener('reload', function(e) {
+		if (JSON.parse(e.data).kind === 'restart')
+			restarting = true;
+		else
+			location.reload();
+	});
+	es.onopen = function() { if (restarting) location.reload(); };
+})();
+</script>`
+
+// SSEHandler returns a HTTP handler that streams server-sent events to
+// browsers, to reload the page when something changes; see LiveReloadJS.
+//
+//    http.Handle("/debug/reload/events", reload.SSEHandler())
+//
+// A reload event is sent when a Dir() callback ran, with "dir" as the kind, and
+// when the process is about to restart, with "restart" as the kind:
+//
+//    event: reload
+//    data: {"path":"/src/tpl","kind":"dir"}
+//
+// A comment is sent every 25 seconds so that proxies don't close the
+// connection. Events are dropped for clients that can't keep up.
+func SSEHandler() http.Handler {
+	return http.HandlerFunc(serveSSE)
+}
+
+var (
+	sseMu        sync.Mutex
+	sseClients   = make(map[chan sseEvent]struct{})
+	sseHeartbeat = 25 * time.Second
+)
+
+type sseEvent struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+func serveSSE(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan sseEvent, 8)
+	sseMu.Lock()
+	sseClients[ch] = struct{}{}
+	sseMu.Unlock()
+	defer func() {
+		sseMu.Lock()
+		delete(sseClients, ch)
+		sseMu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	t := time.NewTicker(sseHeartbeat)
+	defer t.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case e := <-ch:
+			j, _ := json.Marshal(e)
+			_, err = fmt.Fprintf(w, "event: reload\ndata: %s\n\n", j)
+		}
+		if err != nil {
+			return
+		}
+		f.Flush()
+	}
+}
+
+// Send the event to all SSEHandler() clients, without blocking.
+func broadcastSSE(e Event) {
+	var s sseEvent
+	switch e.Kind {
+	case CallbackRan:
+		s = sseEvent{Path: e.Path, Kind: "dir"}
+	case RestartScheduled:
+		s = sseEvent{Path: e.Path, Kind: "restart"}
+	default:
+		return
+	}
+
+	sseMu.Lock()
+	defer sseMu.Unlock()
+	for ch := range sseClients {
+		select {
+		case ch <- s:
+		default:
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package reload
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEHandler(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	oldHeartbeat := sseHeartbeat
+	defer func() { sseHeartbeat = oldHeartbeat }()
+	sseHeartbeat = 50 * time.Millisecond
+
+	srv := httptest.NewServer(SSEHandler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type: %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		s := bufio.NewScanner(resp.Body)
+		for s.Scan() {
+			if s.Text() != "" {
+				lines <- s.Text()
+			}
+		}
+	}()
+	next := func(want string) {
+		t.Helper()
+		for {
+			select {
+			case l := <-lines:
+				if strings.HasPrefix(l, ":") && !strings.HasPrefix(want, ":") {
+					continue
+				}
+				if l != want {
+					t.Fatalf("\ngot:  %q\nwant: %q", l, want)
+				}
+				return
+			case <-time.After(2 * time.Second):
+				t.Fatalf("timeout waiting for %q", want)
+			}
+		}
+	}
+	next(": heartbeat")
+
+	var (
+		w       = newFakeWatcher()
+		started = make(chan struct{})
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), WithRestart(func(Reason) {}),
+			Config{OnStart: func([]string) { close(started) }},
+			Dir(tmp, func() {}))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	<-started
+
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "a"), Op: OpCreate | OpWrite}
+	next("event: reload")
+	j, _ := json.Marshal(sseEvent{Path: tmp, Kind: "dir"})
+	next("data: " + string(j))
+
+	Restart()
+	next("event: reload")
+	next(`data: {"path":"","kind":"restart"}`)
+
+	// Client is removed after disconnecting.
+	resp.Body.Close()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		sseMu.Lock()
+		n := len(sseClients)
+		sseMu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Fatalf("%d clients after disconnecting", n)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package reload
+
+import (
+	"sync"
+	"time"
+)
+
+// Statistics are counters for what Do() did in this process; see Stats().
+type Statistics struct {
+	// Restarts is the number of restarts, including those by Exec() in
+	// previous processes.
+	Restarts int
+
+	// LastRestart is when the last restart in this process was started; this
+	// is the zero time if there wasn't one yet.
+	LastRestart time.Time
+
+	// DirEvents and DirCallbacks are the number of events and callback calls
+	// for every directory added with Dir(), by path.
+	DirEvents    map[string]int
+	DirCallbacks map[string]int
+
+	// WatcherErrors is the number of errors from the watcher.
+	WatcherErrors int
+
+	// EventsSeen is the number of filesystem events, including those that
+	// didn't cause anything to happen.
+	EventsSeen int
+
+	// EventsDropped is the number of events that weren't sent to Events()
+	// because the channel was full.
+	EventsDropped int
+
+	// BinaryDirMissing is true while the binary's directory doesn't exist,
+	// during which changes to the binary aren't noticed.
+	BinaryDirMissing bool
+
+	// RestartPending is true while a restart is postponed by
+	// WithRestartWindow(), Config.CanRestart, or WithBusyCheck(). Use
+	// Pending() for the details.
+	RestartPending bool
+}
+
+var (
+	statsMu sync.Mutex
+	stats   = Statistics{
+		// Exec() replaces the process, so start from the number of restarts
+		// before this one.
+		Restarts:     Generation(),
+		DirEvents:    make(map[string]int),
+		DirCallbacks: make(map[string]int),
+	}
+)
+
+// Stats gets a copy of the counters, for example to export them as metrics.
+func Stats() Statistics {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	s := stats
+	s.DirEvents = make(map[string]int, len(stats.DirEvents))
+	for k, v := range stats.DirEvents {
+		s.DirEvents[k] = v
+	}
+	s.DirCallbacks = make(map[string]int, len(stats.DirCallbacks))
+	for k, v := range stats.DirCallbacks {
+		s.DirCallbacks[k] = v
+	}
+	return s
+}
+
+func countStats(fn func(s *Statistics)) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	fn(&stats)
+}
+
+func countRestart() {
+	countStats(func(s *Statistics) {
+		s.Restarts++
+		s.LastRestart = time.Now()
+	})
+}
+
+func countDirEvent(path string) {
+	countStats(func(s *Statistics) { s.DirEvents[path]++ })
+}
+
+func countDirCallback(path string) {
+	countStats(func(s *Statistics) { s.DirCallbacks[path]++ })
+}
+
+func countWatcherError() {
+	countStats(func(s *Statistics) { s.WatcherErrors++ })
+}
+
+func countEvent() {
+	countStats(func(s *Statistics) { s.EventsSeen++ })
+}
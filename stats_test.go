@@ -0,0 +1,85 @@
+package reload
+
+import (
+	"errors"
+	"expvar"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		before    = Stats()
+		w         = newFakeWatcher()
+		called    = make(chan struct{}, 1)
+		restarted = make(chan struct{}, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), WithExpvar(),
+			Dir(tmp, func() { called <- struct{}{} }),
+			WithRestart(func(Reason) { restarted <- struct{}{} }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	wait := func(ch chan struct{}) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "file"), Op: OpCreate | OpWrite}
+	wait(called)
+	w.errors <- errors.New("oops")
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	wait(restarted)
+
+	after := Stats()
+	if d := after.Restarts - before.Restarts; d != 1 {
+		t.Errorf("restarts: %d", d)
+	}
+	if d := after.EventsSeen - before.EventsSeen; d != 2 {
+		t.Errorf("events seen: %d", d)
+	}
+	if d := after.WatcherErrors - before.WatcherErrors; d != 1 {
+		t.Errorf("watcher errors: %d", d)
+	}
+	if after.DirEvents[tmp] != 1 || after.DirCallbacks[tmp] != 1 {
+		t.Errorf("dir events: %v; dir callbacks: %v", after.DirEvents, after.DirCallbacks)
+	}
+	if after.LastRestart.IsZero() {
+		t.Error("last restart not set")
+	}
+
+	m := expvar.Get("reload").(*expvar.Map)
+	for k, want := range map[string]string{
+		"restarts":       strconv.Itoa(after.Restarts),
+		"events_seen":    strconv.Itoa(after.EventsSeen),
+		"watcher_errors": strconv.Itoa(after.WatcherErrors),
+	} {
+		if got := m.Get(k).String(); got != want {
+			t.Errorf("%s: got %s; want %s", k, got, want)
+		}
+	}
+	if !strings.Contains(m.Get("dir_callbacks").String(), strconv.Quote(tmp)) {
+		t.Errorf("dir_callbacks: %s", m.Get("dir_callbacks"))
+	}
+}
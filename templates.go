@@ -0,0 +1,85 @@
+package reload
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"path/filepath"
+	"sync"
+	texttemplate "text/template"
+)
+
+// TemplateSet are templates that are parsed again when they change; see
+// Templates().
+type TemplateSet struct {
+	glob string
+	mu   sync.RWMutex
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Templates parses all files matching glob as templates, and parses them again
+// when anything in the glob's directory changes once it's passed to Do():
+//
+//    tpl, err := reload.Templates("tpl/*.html")
+//    if err != nil {
+//        log.Fatal(err)
+//    }
+//    go func() {
+//        err := reload.Do(log.Printf, tpl)
+//        if err != nil {
+//            log.Print(err)
+//        }
+//    }()
+//
+//    tpl.HTML().ExecuteTemplate(w, "index.html", data)
+//
+// The previous templates are kept if parsing them again fails; the error is
+// logged and sent to Errors(). It's safe to use the templates from several
+// goroutines while they're being reloaded.
+func Templates(glob string) (*TemplateSet, error) {
+	t := &TemplateSet{glob: glob}
+	if err := t.parse(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *TemplateSet) apply(r *reloader) {
+	Dir(filepath.Dir(t.glob), t.reload).apply(r)
+}
+
+// HTML gets the templates as html/template.
+func (t *TemplateSet) HTML() *htmltemplate.Template {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.html
+}
+
+// Text gets the templates as text/template.
+func (t *TemplateSet) Text() *texttemplate.Template {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.text
+}
+
+func (t *TemplateSet) reload() {
+	if err := t.parse(); err != nil {
+		logError(logger, err)
+	}
+}
+
+func (t *TemplateSet) parse() error {
+	html, err := htmltemplate.ParseGlob(t.glob)
+	if err != nil {
+		return fmt.Errorf("reload.Templates: %w", err)
+	}
+	text, err := texttemplate.ParseGlob(t.glob)
+	if err != nil {
+		return fmt.Errorf("reload.Templates: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.html, t.text = html, text
+	return nil
+}
@@ -0,0 +1,81 @@
+package reload
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplates(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		file = filepath.Join(tmp, "a.html")
+		set  *TemplateSet
+	)
+	write := func(s string) {
+		t.Helper()
+		if err := ioutil.WriteFile(file, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec := func() string {
+		t.Helper()
+		var html, text strings.Builder
+		if err := set.HTML().ExecuteTemplate(&html, "a.html", "<x>"); err != nil {
+			t.Fatal(err)
+		}
+		if err := set.Text().ExecuteTemplate(&text, "a.html", "<x>"); err != nil {
+			t.Fatal(err)
+		}
+		return html.String() + " " + text.String()
+	}
+
+	if _, err := Templates(filepath.Join(tmp, "*.html")); err == nil {
+		t.Error("no error for glob without any files")
+	}
+
+	write("one {{.}}")
+	set, err = Templates(filepath.Join(tmp, "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exec(); got != "one &lt;x&gt; one <x>" {
+		t.Errorf("got %q", got)
+	}
+
+	var (
+		l = new(testLogger)
+		w = newFakeWatcher()
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), set)
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	write("two {{.}}")
+	w.events <- WatchEvent{Name: file, Op: OpWrite}
+	for start := time.Now(); exec() != "two &lt;x&gt; two <x>"; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			t.Fatalf("not reloaded: %q", exec())
+		}
+	}
+
+	// Keep the old templates if there's an error.
+	write("three {{.")
+	w.events <- WatchEvent{Name: file, Op: OpWrite}
+	l.wait(t, "ERROR reload error: reload.Templates:")
+	if got := exec(); got != "two &lt;x&gt; two <x>" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,15 @@
+package reload
+
+// WatchTrigger restarts the process when anything is written to the named pipe
+// (FIFO) at path, for example from a deploy script with:
+//
+//    echo > /tmp/reload.fifo
+//
+// This is an alternative to WithSignal() for when sending a signal is awkward,
+// such as in a container. The FIFO is created if it doesn't exist, and removed
+// when Do() returns.
+//
+// This isn't supported on Windows; Do() will return an error.
+func WatchTrigger(path string) Option {
+	return optionFunc(func(r *reloader) { r.trigger = path })
+}
@@ -0,0 +1,72 @@
+//go:build !windows
+// +build !windows
+
+package reload
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchTrigger(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	file := filepath.Join(tmp, "file")
+	if err := ioutil.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = Do(log.Printf, WithWatcher(newFakeWatcher()), WatchTrigger(file))
+	if !errorContains(err, "isn't a FIFO") {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	var (
+		fifo      = filepath.Join(tmp, "reload.fifo")
+		started   = make(chan struct{})
+		restarted = make(chan Reason, 2)
+		done      = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		err := Do(log.Printf, WithWatcher(newFakeWatcher()), WatchTrigger(fifo),
+			Config{OnStart: func([]string) { close(started) }},
+			WithRestart(func(r Reason) { restarted <- r }))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	<-started
+
+	for i := 0; i < 2; i++ {
+		fp, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp.Write([]byte("\n"))
+		fp.Close()
+
+		select {
+		case r := <-restarted:
+			if r.Kind != Trigger || r.Path != fifo {
+				t.Errorf("wrong reason: %#v", r)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("not restarted")
+		}
+	}
+
+	Stop()
+	<-done
+	if _, err := os.Stat(fifo); !os.IsNotExist(err) {
+		t.Errorf("FIFO not removed: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build !windows
+// +build !windows
+
+package reload
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Create the FIFO for WatchTrigger() if needed, and start reading from it.
+func watchTrigger(path string) (stop func(), err error) {
+	st, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		if err := syscall.Mkfifo(path, 0o600); err != nil {
+			return nil, fmt.Errorf("cannot create trigger FIFO %q: %w", path, err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("cannot use trigger FIFO: %w", err)
+	case st.Mode()&os.ModeNamedPipe == 0:
+		return nil, fmt.Errorf("trigger %q exists and isn't a FIFO", path)
+	}
+
+	// Open for writing as well, so that opening doesn't block until there's a
+	// writer and reads don't return EOF once a writer closes it.
+	fp, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open trigger FIFO: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 512)
+		for {
+			// Returns an error once it's closed.
+			if _, err := fp.Read(buf); err != nil {
+				return
+			}
+			select {
+			case manual <- Reason{Kind: Trigger, Path: path}:
+			default:
+			}
+		}
+	}()
+
+	return func() {
+		fp.Close()
+		<-done
+		os.Remove(path)
+	}, nil
+}
@@ -0,0 +1,7 @@
+package reload
+
+import "errors"
+
+func watchTrigger(string) (func(), error) {
+	return nil, errors.New("WatchTrigger() isn't supported on Windows")
+}
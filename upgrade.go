@@ -0,0 +1,248 @@
+//go:build !windows
+// +build !windows
+
+package reload
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type listener struct {
+	network, addr string
+	l             net.Listener
+	f             *os.File // Inherited from the parent; nil once used.
+}
+
+var (
+	listenMu    sync.Mutex
+	listeners   []listener
+	inherited   []listener
+	inheritOnce sync.Once
+)
+
+// Read the listeners passed by GracefulUpgrade in the parent process.
+func inherit() {
+	env := os.Getenv(envListeners)
+	os.Unsetenv(envListeners)
+	if env == "" {
+		return
+	}
+	for i, n := range strings.Split(env, ",") {
+		s := strings.SplitN(n, "/", 2)
+		if len(s) != 2 {
+			continue
+		}
+		inherited = append(inherited, listener{network: s[0], addr: s[1],
+			f: os.NewFile(uintptr(3+i), n)})
+	}
+}
+
+// Listen announces on the local network address, like net.Listen.
+//
+// If the process was started by GracefulUpgrade and the parent was listening
+// on the same address then that listener is inherited, so that no connections
+// are refused during the upgrade. Listeners that were closed aren't passed to
+// the new process.
+func Listen(network, addr string) (net.Listener, error) {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	inheritOnce.Do(inherit)
+
+	for i := range inherited {
+		in := &inherited[i]
+		if in.f == nil || in.network != network || in.addr != addr {
+			continue
+		}
+		l, err := net.FileListener(in.f)
+		in.f.Close()
+		in.f = nil
+		if err != nil {
+			return nil, fmt.Errorf("reload.Listen: cannot use inherited listener for %q: %w", addr, err)
+		}
+		listeners = append(listeners, listener{network: network, addr: addr, l: l})
+		return &trackedListener{l}, nil
+	}
+
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	listeners = append(listeners, listener{network: network, addr: addr, l: l})
+	return &trackedListener{l}, nil
+}
+
+// trackedListener removes the listener from the ones passed to the new process
+// by GracefulUpgrade when it's closed.
+type trackedListener struct{ net.Listener }
+
+func (t *trackedListener) Close() error {
+	listenMu.Lock()
+	for i := range listeners {
+		if listeners[i].l == t.Listener {
+			listeners = append(listeners[:i], listeners[i+1:]...)
+			break
+		}
+	}
+	listenMu.Unlock()
+	return t.Listener.Close()
+}
+
+// Ready tells the parent process that started this one with GracefulUpgrade
+// that we're ready to serve, after which the parent will shut down.
+//
+// This does nothing if the process wasn't started by GracefulUpgrade.
+func Ready() error {
+	fd, err := strconv.Atoi(os.Getenv(envReadyFD))
+	if err != nil {
+		return nil
+	}
+	os.Unsetenv(envReadyFD)
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		return fmt.Errorf("reload.Ready: %w", err)
+	}
+	return nil
+}
+
+// GracefulUpgrade returns a restart function for RestartExec which starts the
+// new binary as a child process while this one keeps serving, rather than
+// replacing the process in-place.
+//
+// Listeners created with Listen() are passed to the new process. Once the new
+// process calls Ready() the shutdown function is called to finish in-flight
+// requests, after which this process exits. We exit anyway if shutdown doesn't
+// return within the timeout or Config.DrainTimeout, whichever comes first.
+//
+// If the new process fails to start, exits, or doesn't call Ready() within the
+// timeout then the error is logged and this process keeps running.
+//
+//    reload.RestartExec = reload.GracefulUpgrade(10*time.Second, srv.Shutdown)
+//    err := reload.Do(log.Printf, reload.WithSignal(syscall.SIGUSR2))
+func GracefulUpgrade(timeout time.Duration, shutdown func(context.Context) error) func() {
+	return func() {
+		if err := upgrade(timeout); err != nil {
+			logError(logger, &RestartError{Err: fmt.Errorf("graceful upgrade failed, keeping the old process running: %w", err)})
+			return
+		}
+
+		if closeWatcher != nil {
+			closeWatcher()
+		}
+		drainCtx, cancel := drainContext()
+		defer cancel()
+		if shutdown != nil {
+			ctx, cancel := context.WithTimeout(drainCtx, timeout)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- shutdown(ctx) }()
+			select {
+			case err := <-done:
+				if err != nil {
+					logger.Errorf("reload: graceful upgrade: shutdown: %v", err)
+				}
+			case <-ctx.Done():
+				if drainCtx.Err() != nil {
+					logger.Errorf("reload: graceful upgrade: shutdown timeout of %s reached while waiting for shutdown; exiting anyway", shutdownTimeout)
+				} else {
+					logger.Errorf("reload: graceful upgrade: shutdown didn't finish in %s; exiting anyway", timeout)
+				}
+			}
+		}
+		drain(drainCtx, logger, false)
+		os.Exit(0)
+	}
+}
+
+// Start the new process and wait for it to become ready.
+func upgrade(timeout time.Duration) error {
+	_, bin := binPaths()
+	if bin == "" {
+		var err error
+		bin, err = self()
+		if err != nil {
+			return err
+		}
+	}
+
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	files, names, err := listenerFiles()
+	if err != nil {
+		wr.Close()
+		return err
+	}
+
+	cmd := exec.Command(bin, execArgs()...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdio()
+	cmd.ExtraFiles = append(files, wr)
+	cmd.Env = execEnv(
+		envListeners+"="+strings.Join(names, ","),
+		envReadyFD+"="+strconv.Itoa(3+len(files)))
+	err = cmd.Start()
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot start %q: %w", bin, err)
+	}
+
+	// Read will return EOF if the process exits without calling Ready(), as
+	// all write ends of the pipe will be closed.
+	ready := make(chan error, 1)
+	go func() {
+		_, err := rd.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err == nil {
+			return nil
+		}
+		cmd.Process.Kill()
+		return fmt.Errorf("new process exited before it was ready: %v", cmd.Wait())
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("new process not ready after %s", timeout)
+	}
+}
+
+// Get duplicated files for all listeners created with Listen().
+func listenerFiles() ([]*os.File, []string, error) {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+
+	files := make([]*os.File, 0, len(listeners))
+	names := make([]string, 0, len(listeners))
+	for _, l := range listeners {
+		fl, ok := l.l.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		f, err := fl.File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, nil, fmt.Errorf("cannot get file for listener %q: %w", l.addr, err)
+		}
+		files = append(files, f)
+		names = append(names, l.network+"/"+l.addr)
+	}
+	return files, names, nil
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package reload
+
+import (
+	"os"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	defer func() { listeners = nil }()
+
+	// Closed listeners aren't passed on.
+	closed, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := closed.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	files, names, err := listenerFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if len(files) != 1 || len(names) != 1 || names[0] != "tcp/127.0.0.1:0" {
+		t.Fatalf("files: %v; names: %v", files, names)
+	}
+
+	// Not started by GracefulUpgrade.
+	os.Unsetenv(envReadyFD)
+	if err := Ready(); err != nil {
+		t.Fatal(err)
+	}
+}
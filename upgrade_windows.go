@@ -0,0 +1,22 @@
+package reload
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Listen announces on the local network address, like net.Listen.
+//
+// Inheriting listeners isn't supported on Windows, so this is identical to
+// net.Listen.
+func Listen(network, addr string) (net.Listener, error) { return net.Listen(network, addr) }
+
+// Ready does nothing on Windows.
+func Ready() error { return nil }
+
+// GracefulUpgrade isn't supported on Windows; the returned function only logs
+// an error.
+func GracefulUpgrade(timeout time.Duration, shutdown func(context.Context) error) func() {
+	return func() { logger.Errorf("reload: graceful upgrade is not supported on Windows") }
+}
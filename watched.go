@@ -0,0 +1,63 @@
+package reload
+
+import "sync"
+
+// WatchedPaths is what Do() is currently watching; see Watched().
+type WatchedPaths struct {
+	// Binary is the path to the binary that's restarted when it changes; this
+	// is empty if Config.IgnoreBinary is set.
+	Binary string
+
+	// Dirs are all directories added to the watcher, including the binary's
+	// directory and subdirectories from DirRecursive().
+	Dirs []string
+
+	// Callbacks are the paths given to Dir(), DirRecursive(), DirFiles(), and
+	// Glob(), in the order they were given.
+	Callbacks []string
+}
+
+var (
+	watchedMu sync.Mutex
+	watched   WatchedPaths
+)
+
+// Watched gets a copy of what Do() is currently watching, for example to show
+// it on a debug page. Directories that were removed are no longer listed, and
+// new subdirectories for DirRecursive() are added as they're created.
+//
+// Everything is empty if Do() isn't running.
+func Watched() WatchedPaths {
+	watchedMu.Lock()
+	defer watchedMu.Unlock()
+
+	w := watched
+	w.Dirs = append([]string(nil), watched.Dirs...)
+	w.Callbacks = append([]string(nil), watched.Callbacks...)
+	return w
+}
+
+func setWatched(w WatchedPaths) {
+	watchedMu.Lock()
+	defer watchedMu.Unlock()
+	watched = w
+}
+
+func addWatched(dir string) {
+	watchedMu.Lock()
+	defer watchedMu.Unlock()
+	if !contains(watched.Dirs, dir) {
+		watched.Dirs = append(watched.Dirs, dir)
+	}
+}
+
+func removeWatched(dir string) {
+	watchedMu.Lock()
+	defer watchedMu.Unlock()
+	for i, d := range watched.Dirs {
+		if d == dir {
+			watched.Dirs = append(watched.Dirs[:i:i], watched.Dirs[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package reload
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWatched(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Mkdir(filepath.Join(tmp, "a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		w       = newFakeWatcher()
+		started = make(chan struct{})
+		tpl     = filepath.Join(tmp, "*.tmpl")
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w),
+			Config{IgnoreBinary: true, OnStart: func([]string) { close(started) }},
+			DirRecursive(tmp, func() {}),
+			Glob(tpl, func() {}))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	<-started
+
+	want := WatchedPaths{
+		Dirs:      []string{tmp, filepath.Join(tmp, "a")},
+		Callbacks: []string{tmp, tpl},
+	}
+	if got := Watched(); !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	// Sending another event makes sure the previous one was handled.
+	if err := os.Mkdir(filepath.Join(tmp, "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "b"), Op: OpCreate}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "a"), Op: OpRemove}
+	w.events <- WatchEvent{Name: filepath.Join(tmp, "x"), Op: OpChmod}
+
+	want.Dirs = []string{tmp, filepath.Join(tmp, "b")}
+	if got := Watched(); !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	Stop()
+	if got := Watched(); !reflect.DeepEqual(got, WatchedPaths{}) {
+		t.Errorf("not empty after Stop(): %#v", got)
+	}
+}
@@ -0,0 +1,56 @@
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// Watcher watches directories for changes. The default uses fsnotify; a
+// different implementation can be set with WithWatcher(), which is mostly
+// useful for tests (see the reloadtest package).
+type Watcher interface {
+	Events() <-chan WatchEvent
+	Errors() <-chan error
+	Add(path string) error
+	Close() error
+}
+
+// WithWatcher uses a custom Watcher instead of fsnotify.
+//
+// It's not closed if a restart function from WithRestart() or Config.Restart
+// returns, as it can't be recreated. Exec() does close it, and if Exec() fails
+// after that a WatchError is reported and reload stops watching.
+func WithWatcher(w Watcher) Option {
+	return optionFunc(func(r *reloader) { r.watcher = w })
+}
+
+// Add a directory to the watcher, with a helpful error if the inotify watch
+// limit was reached.
+func addWatch(w Watcher, path string) error {
+	err := w.Add(path)
+	if err == nil {
+		return nil
+	}
+	if runtime.GOOS == "linux" && errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("cannot add %q to watcher: %w; the inotify watch limit was reached; "+
+			"raise it with e.g. \"sysctl fs.inotify.max_user_watches=524288\" "+
+			"(add to /etc/sysctl.conf to make it permanent)", path, err)
+	}
+	return fmt.Errorf("cannot add %q to watcher: %w", path, err)
+}
+
+// How often to try recreating the watcher after a fatal error.
+const maxWatchRecreate = 5
+
+// How often to check if the binary's directory was created again after it was
+// removed.
+var binDirPollInterval = time.Second
+
+// Errors after which the watcher won't send any more events.
+func isFatal(err error) bool {
+	return errors.Is(err, syscall.EBADF) || errors.Is(err, syscall.EINVAL) || errors.Is(err, os.ErrClosed)
+}
@@ -0,0 +1,338 @@
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type errWatcher struct{ err error }
+
+func (w errWatcher) Events() <-chan WatchEvent { return nil }
+func (w errWatcher) Errors() <-chan error      { return nil }
+func (w errWatcher) Add(string) error          { return w.err }
+func (w errWatcher) Close() error              { return nil }
+
+func TestAddWatch(t *testing.T) {
+	err := addWatch(errWatcher{syscall.ENOSPC}, "/dir")
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("not wrapped: %v", err)
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(err.Error(), "fs.inotify.max_user_watches") {
+		t.Errorf("no hint: %v", err)
+	}
+
+	err = addWatch(errWatcher{syscall.EACCES}, "/dir")
+	if strings.Contains(err.Error(), "inotify") {
+		t.Errorf("hint for wrong error: %v", err)
+	}
+
+	if err := addWatch(errWatcher{}, "/dir"); err != nil {
+		t.Error(err)
+	}
+}
+
+type fakeWatcher struct {
+	events chan WatchEvent
+	errors chan error
+
+	mu     sync.Mutex
+	added  []string
+	closed bool
+}
+
+func newFakeWatcher() *fakeWatcher {
+	return &fakeWatcher{events: make(chan WatchEvent), errors: make(chan error)}
+}
+
+func (w *fakeWatcher) Events() <-chan WatchEvent { return w.events }
+func (w *fakeWatcher) Errors() <-chan error      { return w.errors }
+
+func (w *fakeWatcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *fakeWatcher) Add(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.added = append(w.added, path)
+	return nil
+}
+
+func (w *fakeWatcher) Closed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+func (w *fakeWatcher) Added() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.added...)
+}
+
+func TestRecoverWatcher(t *testing.T) {
+	var (
+		watchers  = make(chan *fakeWatcher, 3)
+		restarted = make(chan struct{}, 1)
+	)
+	newWatcher := optionFunc(func(r *reloader) {
+		r.newWatcher = func() (Watcher, error) {
+			w := newFakeWatcher()
+			watchers <- w
+			return w, nil
+		}
+	})
+	go func() {
+		err := Do(log.Printf, newWatcher, WithRestart(func(Reason) { restarted <- struct{}{} }), Config{StartupGrace: -1})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	w1 := <-watchers
+	w1.errors <- fmt.Errorf("read: %w", syscall.EBADF)
+	w2 := <-watchers
+
+	// Closing the event channel also recreates it.
+	close(w2.events)
+	w3 := <-watchers
+
+	_, launch := binPaths()
+	w3.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("not restarted with new watcher")
+	}
+	if !reflect.DeepEqual(w1.Added(), w3.Added()) {
+		t.Errorf("\nfirst: %q\nthird: %q", w1.Added(), w3.Added())
+	}
+}
+
+func TestWatcherClosed(t *testing.T) {
+	var (
+		w       = newFakeWatcher()
+		started = make(chan struct{})
+		ret     = make(chan error, 1)
+	)
+	go func() {
+		ret <- Do(log.Printf, WithWatcher(w), Config{OnStart: func([]string) { close(started) }})
+	}()
+	<-started
+
+	close(w.events)
+	select {
+	case err := <-ret:
+		var werr *WatchError
+		if !errors.As(err, &werr) || !errorContains(err, "event channel closed") {
+			t.Errorf("wrong error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Do() didn't return after the watcher was closed")
+	}
+	if !w.Closed() {
+		t.Error("watcher not closed")
+	}
+	Stop() // Does nothing, as Do() already returned.
+}
+
+func TestWatcherFatalError(t *testing.T) {
+	var (
+		w       = newFakeWatcher()
+		started = make(chan struct{})
+		ret     = make(chan error, 1)
+		onErr   = make(chan error, 1)
+	)
+	defer OnError(nil)
+	OnError(func(err error) { onErr <- err })
+	go func() {
+		ret <- Do(log.Printf, WithWatcher(w), Config{OnStart: func([]string) { close(started) }})
+	}()
+	<-started
+
+	// WithWatcher() watchers can't be recreated.
+	w.errors <- fmt.Errorf("read: %w", syscall.EBADF)
+	select {
+	case err := <-ret:
+		if !errors.Is(err, syscall.EBADF) {
+			t.Errorf("wrong error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Do() didn't return after a fatal error")
+	}
+
+	// Also reported, as Do() usually runs in a goroutine.
+	select {
+	case err := <-onErr:
+		var werr *WatchError
+		if !errors.As(err, &werr) || !errors.Is(err, syscall.EBADF) {
+			t.Errorf("wrong error: %#v", err)
+		}
+	default:
+		t.Error("OnError not called")
+	}
+}
+
+func TestBinaryDirRemoved(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		binDir = filepath.Join(tmp, "bin")
+		app    = filepath.Join(binDir, "app")
+	)
+	if err := os.Mkdir(binDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(app, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldSelf, oldLaunch, oldPoll := binSelf, binLaunch, binDirPollInterval
+	defer func() { binSelf, binLaunch, binDirPollInterval = oldSelf, oldLaunch, oldPoll }()
+	binDirPollInterval = 10 * time.Millisecond
+
+	var (
+		w         = newFakeWatcher()
+		restarted = make(chan Reason, 1)
+	)
+	go func() {
+		err := Do(log.Printf, WithWatcher(w), WithRestart(func(r Reason) { restarted <- r }),
+			Config{ResolveBinary: func() (string, error) { return app, nil }})
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+
+	if err := os.RemoveAll(binDir); err != nil {
+		t.Fatal(err)
+	}
+	w.events <- WatchEvent{Name: binDir, Op: OpRemove}
+	// Wait for the loop to be ready for events again.
+	w.events <- WatchEvent{Name: "/ignored", Op: OpCreate | OpWrite}
+	if !Stats().BinaryDirMissing {
+		t.Error("BinaryDirMissing not set")
+	}
+
+	if err := os.Mkdir(binDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(app, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-restarted:
+		if r.Path != app {
+			t.Errorf("wrong path: %q", r.Path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("not restarted after the directory was created again")
+	}
+	if Stats().BinaryDirMissing {
+		t.Error("BinaryDirMissing still set")
+	}
+	if got := w.Added(); len(got) < 2 || got[0] != binDir || got[1] != binDir {
+		t.Errorf("not watched again: %q", got)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		dir = filepath.Join(tmp, "dir")
+		app = filepath.Join(tmp, "app")
+	)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(app, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldSelf, oldLaunch := binSelf, binLaunch
+	defer func() { binSelf, binLaunch = oldSelf, oldLaunch }()
+
+	tests := []struct {
+		name              string
+		event             WatchEvent
+		wantCB, wantStart bool
+	}{
+		{"write in dir", WatchEvent{Name: filepath.Join(dir, "a"), Op: OpWrite}, true, false},
+		{"chmod in dir", WatchEvent{Name: filepath.Join(dir, "a"), Op: OpChmod}, false, false},
+		{"write in subdir", WatchEvent{Name: filepath.Join(dir, "sub", "a"), Op: OpWrite}, true, false},
+		{"sibling dir", WatchEvent{Name: dir + "-old", Op: OpWrite}, false, false},
+		{"other dir", WatchEvent{Name: filepath.Join(tmp, "a"), Op: OpWrite}, false, false},
+		{"write binary", WatchEvent{Name: app, Op: OpWrite}, false, true},
+		{"chmod binary", WatchEvent{Name: app, Op: OpChmod}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w         = newFakeWatcher()
+				called    = make(chan struct{}, 1)
+				restarted = make(chan struct{}, 1)
+			)
+			go func() {
+				err := Do(log.Printf, WithWatcher(w),
+					Dir(dir, func() { called <- struct{}{} }),
+					WithRestart(func(Reason) { restarted <- struct{}{} }),
+					Config{
+						TriggerOp:     OpWrite,
+						ResolveBinary: func() (string, error) { return app, nil },
+					})
+				if err != nil {
+					panic(err)
+				}
+			}()
+			defer Stop()
+
+			w.events <- tt.event
+			var gotCB, gotStart bool
+			timeout := time.After(300 * time.Millisecond)
+			for !gotCB || !gotStart {
+				select {
+				case <-called:
+					gotCB = true
+					continue
+				case <-restarted:
+					gotStart = true
+					continue
+				case <-timeout:
+				}
+				break
+			}
+			if gotCB != tt.wantCB || gotStart != tt.wantStart {
+				t.Errorf("callback: %t, restart: %t; want %t, %t", gotCB, gotStart, tt.wantCB, tt.wantStart)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package reload
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// WithRestartWindow only restarts during the given daily time ranges, in the
+// timezone loc (time.Local if nil). Ranges are written as "HH:MM-HH:MM", and
+// may go past midnight:
+//
+//    reload.WithRestartWindow(time.Local, "12:00-13:00", "22:00-06:00")
+//
+// Restarts outside the window are postponed until the start of the next one;
+// changes while a restart is postponed don't cause extra restarts, and the
+// binary as it is at that time is started. Dir() callbacks are still run.
+//
+// Use ForceRestart() to restart outside the window; restarts from Restart(),
+// WithSignal(), and Handler() wait for the window too, unless the handler is
+// called with ?force=1 or the signal is from WithForceSignal().
+//
+// Do() returns an error if a range is invalid.
+func WithRestartWindow(loc *time.Location, ranges ...string) Option {
+	return optionFunc(func(r *reloader) {
+		r.window, r.windowErr = parseWindow(loc, ranges)
+	})
+}
+
+// WithForceSignal is like WithSignal, but the restart isn't held back by
+// WithRestartWindow(), like ForceRestart(). For example:
+//
+//    reload.WithSignal(syscall.SIGHUP), reload.WithForceSignal(syscall.SIGUSR2)
+func WithForceSignal(sig ...os.Signal) Option {
+	return optionFunc(func(r *reloader) {
+		r.signals = append(r.signals, sig...)
+		r.force = append(r.force, sig...)
+	})
+}
+
+// Daily time ranges for WithRestartWindow().
+type restartWindow struct {
+	loc    *time.Location
+	ranges [][2]int // Start and end, in minutes since midnight.
+}
+
+func parseWindow(loc *time.Location, ranges []string) (*restartWindow, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("WithRestartWindow: no time ranges")
+	}
+
+	w := &restartWindow{loc: loc}
+	for _, rng := range ranges {
+		s := strings.SplitN(rng, "-", 2)
+		if len(s) != 2 {
+			return nil, fmt.Errorf("WithRestartWindow: invalid range %q: not start-end", rng)
+		}
+		start, err := parseClock(s[0])
+		if err != nil {
+			return nil, fmt.Errorf("WithRestartWindow: invalid range %q: %w", rng, err)
+		}
+		end, err := parseClock(s[1])
+		if err != nil {
+			return nil, fmt.Errorf("WithRestartWindow: invalid range %q: %w", rng, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("WithRestartWindow: invalid range %q: start and end are the same", rng)
+		}
+		w.ranges = append(w.ranges, [2]int{start, end})
+	}
+	return w, nil
+}
+
+// Parse "HH:MM" to minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q; use HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Report if t is inside one of the ranges.
+func (w *restartWindow) contains(t time.Time) bool {
+	t = t.In(w.loc)
+	m := t.Hour()*60 + t.Minute()
+	for _, r := range w.ranges {
+		if r[0] < r[1] && m >= r[0] && m < r[1] {
+			return true
+		}
+		if r[0] > r[1] && (m >= r[0] || m < r[1]) { // Past midnight.
+			return true
+		}
+	}
+	return false
+}
+
+// Get the start of the next range after t.
+func (w *restartWindow) next(t time.Time) time.Time {
+	t = t.In(w.loc)
+	var next time.Time
+	for day := 0; day <= 1; day++ {
+		for _, r := range w.ranges {
+			s := time.Date(t.Year(), t.Month(), t.Day()+day, r[0]/60, r[0]%60, 0, 0, w.loc)
+			if s.After(t) && (next.IsZero() || s.Before(next)) {
+				next = s
+			}
+		}
+	}
+	return next
+}
@@ -0,0 +1,131 @@
+package reload
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		in      []string
+		wantErr string
+	}{
+		{[]string{"12:00-13:00"}, ""},
+		{[]string{"22:00-06:00", " 9:30 - 10:00 "}, ""},
+		{nil, "no time ranges"},
+		{[]string{"12:00"}, "not start-end"},
+		{[]string{"12:00-25:00"}, `invalid time "25:00"`},
+		{[]string{"noon-13:00"}, `invalid time "noon"`},
+		{[]string{"12:00-12:00"}, "start and end are the same"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.in, ","), func(t *testing.T) {
+			_, err := parseWindow(nil, tt.in)
+			if !errorContains(err, tt.wantErr) {
+				t.Errorf("\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestartWindow(t *testing.T) {
+	loc := time.FixedZone("X", 3600)
+	w, err := parseWindow(loc, []string{"12:00-13:00", "22:00-06:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(d, h, m int) time.Time { return time.Date(2024, 3, d, h, m, 0, 0, loc) }
+
+	tests := []struct {
+		in       time.Time
+		contains bool
+		next     time.Time
+	}{
+		{at(10, 11, 59), false, at(10, 12, 0)},
+		{at(10, 12, 0), true, at(10, 22, 0)},
+		{at(10, 12, 59), true, at(10, 22, 0)},
+		{at(10, 13, 0), false, at(10, 22, 0)},
+		{at(10, 23, 30), true, at(11, 12, 0)},
+		{at(11, 5, 59), true, at(11, 12, 0)},
+		{at(11, 6, 0), false, at(11, 12, 0)},
+		{at(10, 12, 30).UTC(), true, at(10, 22, 0)}, // Converted to loc.
+	}
+	for _, tt := range tests {
+		t.Run(tt.in.Format("02 15:04"), func(t *testing.T) {
+			if c := w.contains(tt.in); c != tt.contains {
+				t.Errorf("contains: %t", c)
+			}
+			if n := w.next(tt.in); !n.Equal(tt.next) {
+				t.Errorf("next:\nout:  %s\nwant: %s", n, tt.next)
+			}
+		})
+	}
+}
+
+func TestWithRestartWindow(t *testing.T) {
+	// A window that starts in an hour, so it's never open during the test.
+	now := time.Now()
+	start, end := now.Add(time.Hour), now.Add(2*time.Hour)
+	var (
+		w         = newFakeWatcher()
+		l         = &testLogger{}
+		restarted = make(chan Reason, 3)
+	)
+	go func() {
+		err := Do(nil, WithLogger(l), WithWatcher(w), WithRestart(func(r Reason) { restarted <- r }),
+			WithRestartWindow(nil, start.Format("15:04")+"-"+end.Format("15:04")))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	defer Stop()
+	l.wait(t, "INFO restarting")
+
+	_, launch := binPaths()
+	w.events <- WatchEvent{Name: launch, Op: OpCreate | OpWrite}
+	l.wait(t, "INFO reload: not restarting yet, as it's outside the restart window until "+start.Format("15:04"))
+	if !Stats().RestartPending {
+		t.Error("RestartPending not set")
+	}
+	ok, p := Pending()
+	if !ok || p.Policy != HeldByWindow || p.Reason.Kind != BinaryChanged {
+		t.Errorf("wrong Pending(): %t %#v", ok, p)
+	}
+	Restart()
+	select {
+	case <-restarted:
+		t.Fatal("restarted outside the window")
+	case <-time.After(200 * time.Millisecond):
+	}
+	// The latest reason is kept, but it's still held back since it was first
+	// detected.
+	if _, p2 := Pending(); p2.Reason.Kind != Manual || !p2.Detected.Equal(p.Detected) {
+		t.Errorf("wrong Pending(): %#v", p2)
+	}
+
+	ForceRestart()
+	select {
+	case r := <-restarted:
+		if !r.Force {
+			t.Errorf("Force not set: %#v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not restarted")
+	}
+	select {
+	case <-restarted:
+		t.Error("restarted twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if Stats().RestartPending {
+		t.Error("RestartPending still set")
+	}
+}
+
+func TestWithRestartWindowError(t *testing.T) {
+	err := Do(nil, WithLogger(&testLogger{}), WithWatcher(newFakeWatcher()), WithRestartWindow(nil, "nope"))
+	if !errorContains(err, `reload.Do: WithRestartWindow: invalid range "nope"`) {
+		t.Errorf("wrong error: %v", err)
+	}
+}